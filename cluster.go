@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//NodeStats is the result of polling a single node in the cluster
+type NodeStats struct {
+	Datacenter string
+	Node       Node
+	Info       Info
+	CfStats    CfStats
+	Err        error
+}
+
+//DatacenterRollup summarises the polled nodes of a datacenter
+type DatacenterRollup struct {
+	Name            string
+	Nodes           int
+	Reachable       int
+	LoadBytes       int64
+	AvgHeapUsage    float64
+	Exceptions      int64
+	AvgReadLatency  float64
+	AvgWriteLatency float64
+}
+
+//Cluster polls info and cfstats from every node in the ring
+type Cluster struct {
+	//NewSource creates a data source for the node with the given address. Sources are reused for every poll so it is
+	//only called again for a node that left the ring and rejoined.
+	NewSource   func(address string) DataSource
+	Timeout     time.Duration
+	Parallelism int
+
+	mu      sync.Mutex
+	sources map[string]DataSource
+}
+
+//NewCluster constructs a cluster poller that runs nodetool -h against each node using the binary and credentials of
+//the given executor
+func NewCluster(executor CommandExecutor, timeout time.Duration) *Cluster {
+	return &Cluster{
+		NewSource: func(address string) DataSource {
+			node := executor
+			node.Connection.Host = address
+			node.Timeout = timeout
+			return NewNodetoolWithExecutor(&node)
+		},
+		Timeout:     timeout,
+		Parallelism: 8,
+	}
+}
+
+//Poll concurrently fetches info and cfstats from every node in the status. Nodes that are down are not polled.
+func (c *Cluster) Poll(status Status) []NodeStats {
+	results := make([]NodeStats, 0)
+	for _, dc := range status.Datacenters {
+		for _, node := range dc.Nodes {
+			results = append(results, NodeStats{Datacenter: dc.Name, Node: node})
+		}
+	}
+
+	c.forgetDeparted(results)
+
+	sem := make(chan struct{}, max(c.Parallelism, 1))
+	wg := sync.WaitGroup{}
+	for i := range results {
+		if strings.HasPrefix(results[i].Node.State, "D") {
+			results[i].Err = fmt.Errorf("node is down")
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *NodeStats) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			c.pollNode(result)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results
+}
+
+//source returns the data source of a node, creating it on first use so e.g. version detection runs once per node
+func (c *Cluster) source(address string) DataSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sources == nil {
+		c.sources = make(map[string]DataSource)
+	}
+	source, ok := c.sources[address]
+	if !ok {
+		source = c.NewSource(address)
+		c.sources[address] = source
+	}
+	return source
+}
+
+//forgetDeparted drops the data sources of nodes that are no longer in the ring
+func (c *Cluster) forgetDeparted(nodes []NodeStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	present := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		present[node.Node.Address] = true
+	}
+	for address := range c.sources {
+		if !present[address] {
+			delete(c.sources, address)
+		}
+	}
+}
+
+//pollNode fetches the stats for a single node giving up after the timeout
+func (c *Cluster) pollNode(result *NodeStats) {
+	type polled struct {
+		info    Info
+		cfstats CfStats
+		err     error
+	}
+
+	done := make(chan polled, 1)
+	go func() {
+		source := c.source(result.Node.Address)
+		info, err := source.GetInfo()
+		if err != nil {
+			done <- polled{err: err}
+			return
+		}
+		cfstats, err := source.GetCfStats()
+		done <- polled{info: info, cfstats: cfstats, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		result.Info, result.CfStats, result.Err = res.info, res.cfstats, res.err
+	case <-time.After(c.Timeout):
+		result.Err = fmt.Errorf("timed out after %s", c.Timeout)
+	}
+}
+
+//RollupByDatacenter summarises the node stats of each datacenter
+func RollupByDatacenter(stats []NodeStats) []DatacenterRollup {
+	rollups := make([]DatacenterRollup, 0)
+	index := make(map[string]int)
+	for _, node := range stats {
+		i, ok := index[node.Datacenter]
+		if !ok {
+			i = len(rollups)
+			index[node.Datacenter] = i
+			rollups = append(rollups, DatacenterRollup{Name: node.Datacenter})
+		}
+		rollup := &rollups[i]
+		rollup.Nodes++
+		rollup.LoadBytes += node.Node.LoadBytes
+		if node.Err != nil {
+			continue
+		}
+		rollup.Reachable++
+		rollup.AvgHeapUsage += node.Info.HeapUsage
+		rollup.Exceptions += node.Info.Exceptions
+		rollup.AvgReadLatency += node.CfStats.GetAvgReadLatency()
+		rollup.AvgWriteLatency += node.CfStats.GetAvgWriteLatency()
+	}
+
+	for i := range rollups {
+		if rollups[i].Reachable > 0 {
+			rollups[i].AvgHeapUsage /= float64(rollups[i].Reachable)
+			rollups[i].AvgReadLatency /= float64(rollups[i].Reachable)
+			rollups[i].AvgWriteLatency /= float64(rollups[i].Reachable)
+		}
+	}
+	return rollups
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//slowSource never returns so polling it must time out
+type slowSource struct {
+	DataSource
+}
+
+func (s *slowSource) GetInfo() (Info, error) {
+	time.Sleep(time.Hour)
+	return Info{}, nil
+}
+
+func TestClusterPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ntdash-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the fake nodetool prints the fixture named after its arguments so sources are keyed on the connection options
+	fixtures := map[string]string{
+		"-h 10.0.0.1 info":    "Heap Memory (MB) : 25.00 / 100.00\n    Exceptions       : 1",
+		"-h 10.0.0.1 cfstats": "Keyspace: ks1\n    Read Count: 10\n    Read Latency: 2.0 ms.\n    Write Count: 10\n    Write Latency: 1.0 ms.",
+		"-h 10.0.0.2 info":    "Heap Memory (MB) : 75.00 / 100.00\n    Exceptions       : 2",
+		"-h 10.0.0.2 cfstats": "Keyspace: ks1\n    Read Count: 10\n    Read Latency: 4.0 ms.\n    Write Count: 10\n    Write Latency: 3.0 ms.",
+	}
+	for args, out := range fixtures {
+		if err := ioutil.WriteFile(filepath.Join(dir, args), []byte(out), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "nodetool")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec cat \"$(dirname \"$0\")/$*\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	created := 0
+	cluster := NewCluster(CommandExecutor{Path: path}, time.Second)
+	newSource := cluster.NewSource
+	cluster.NewSource = func(address string) DataSource {
+		created++
+		if address == "10.1.0.1" {
+			return &slowSource{}
+		}
+		return newSource(address)
+	}
+	cluster.Timeout = 500 * time.Millisecond
+	cluster.Parallelism = 2
+
+	status := Status{Datacenters: []Datacenter{
+		{Name: "DC1", Nodes: []Node{{State: "UN", Address: "10.0.0.1"}, {State: "UN", Address: "10.0.0.2"}, {State: "DN", Address: "10.0.0.3"}}},
+		{Name: "DC2", Nodes: []Node{{State: "UN", Address: "10.1.0.1"}}},
+	}}
+
+	stats := cluster.Poll(status)
+	if len(stats) != 4 {
+		t.Fatal("Expected a result for every node", stats)
+	}
+	if stats[0].Err != nil || stats[0].Info.Exceptions != 1 || stats[1].CfStats.GetAvgReadLatency() != 4 {
+		t.Error("Node stats are incorrect", stats[0], stats[1])
+	}
+	if stats[2].Err == nil {
+		t.Error("Expected down node to have an error")
+	}
+	if stats[3].Err == nil {
+		t.Error("Expected slow node to time out")
+	}
+
+	//sources are reused so e.g. the version is only detected once per node
+	cluster.Poll(status)
+	if created != 3 {
+		t.Error("Expected a single source per polled node", created)
+	}
+
+	rollups := RollupByDatacenter(stats)
+	if len(rollups) != 2 {
+		t.Fatal("Expected a rollup per datacenter", rollups)
+	}
+	dc1 := rollups[0]
+	if dc1.Name != "DC1" || dc1.Nodes != 3 || dc1.Reachable != 2 || dc1.AvgHeapUsage != 50 || dc1.Exceptions != 3 || dc1.AvgReadLatency != 3 || dc1.AvgWriteLatency != 2 {
+		t.Errorf("DC1 rollup is incorrect %+v", dc1)
+	}
+	if rollups[1].Nodes != 1 || rollups[1].Reachable != 0 {
+		t.Errorf("DC2 rollup is incorrect %+v", rollups[1])
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//Snapshot is the state of the dashboard after a collection. A snapshot is never modified once published so it can
+//be read from any goroutine.
+type Snapshot struct {
+	At                 time.Time
+	NodeDescription    string
+	PcntNodesUN        int
+	Status             Status
+	Info               Info
+	CfStats            CfStats
+	TpStats            TpStats
+	CompactionStats    CompactionStats
+	ProxyHistograms    ProxyHistograms
+	GcStats            GcStats
+	KeyspaceThroughput map[string]Throughput
+	//Keyspaces are the keyspaces with a latency timeseries in alphabetical order
+	Keyspaces []string
+	//Series holds a copy of every timeseries keyed by name e.g. read_latency
+	Series map[string]*Series
+	//SelectedTable is the table TableHistograms belongs to, empty if no table is selected
+	SelectedTable   KeyspaceTable
+	TableHistograms TableHistograms
+	//Cluster holds the stats of every node if cluster polling is enabled
+	Cluster     []NodeStats
+	Failures    []string
+	stale       map[string]bool
+	unsupported map[string]bool
+}
+
+//IsStale returns true if the last attempt to refresh the data from the given command failed
+func (s *Snapshot) IsStale(command string) bool {
+	return s.stale[command]
+}
+
+//IsUnsupported returns true if the data source cannot provide the result of the given command
+func (s *Snapshot) IsUnsupported(command string) bool {
+	return s.unsupported[command]
+}
+
+//GetLatencies returns the read and write latency timeseries (ms) for a statistic (mean, p95 or p99)
+func (s *Snapshot) GetLatencies(statistic string) (read *Series, write *Series) {
+	switch statistic {
+	case "p95":
+		return s.Series["read_p95"], s.Series["write_p95"]
+	case "p99":
+		return s.Series["read_p99"], s.Series["write_p99"]
+	default:
+		return s.Series["read_latency"], s.Series["write_latency"]
+	}
+}
+
+//GetKeyspaceLatencies returns the read and write latency timeseries of a single keyspace. Both are nil for an
+//unknown keyspace.
+func (s *Snapshot) GetKeyspaceLatencies(keyspace string) (read *Series, write *Series) {
+	return s.Series["keyspace_"+keyspace+"_read_latency"], s.Series["keyspace_"+keyspace+"_write_latency"]
+}
+
+//collected is the outcome of a single command
+type collected struct {
+	value interface{}
+	err   error
+}
+
+//collectedSource serves the results of a collection to Data as if they had just been fetched
+type collectedSource struct {
+	results map[string]collected
+}
+
+func (s *collectedSource) get(command string) (interface{}, error) {
+	result, ok := s.results[command]
+	if !ok {
+		return nil, fmt.Errorf("nodetool %s was not collected", command)
+	}
+	return result.value, result.err
+}
+
+func (s *collectedSource) GetStatus() (Status, error) {
+	value, err := s.get("status")
+	status, _ := value.(Status)
+	return status, err
+}
+
+func (s *collectedSource) GetInfo() (Info, error) {
+	value, err := s.get("info")
+	info, _ := value.(Info)
+	return info, err
+}
+
+func (s *collectedSource) GetCfStats() (CfStats, error) {
+	value, err := s.get("cfstats")
+	cfstats, _ := value.(CfStats)
+	return cfstats, err
+}
+
+func (s *collectedSource) GetTpStats() (TpStats, error) {
+	value, err := s.get("tpstats")
+	tpstats, _ := value.(TpStats)
+	return tpstats, err
+}
+
+func (s *collectedSource) GetCompactionStats() (CompactionStats, error) {
+	value, err := s.get("compactionstats")
+	stats, _ := value.(CompactionStats)
+	return stats, err
+}
+
+func (s *collectedSource) GetProxyHistograms() (ProxyHistograms, error) {
+	value, err := s.get("proxyhistograms")
+	histograms, _ := value.(ProxyHistograms)
+	return histograms, err
+}
+
+func (s *collectedSource) GetTableHistograms(keyspace string, table string) (TableHistograms, error) {
+	value, err := s.get("tablehistograms")
+	histograms, _ := value.(TableHistograms)
+	return histograms, err
+}
+
+func (s *collectedSource) GetGcStats() (GcStats, error) {
+	value, err := s.get("gcstats")
+	gcstats, _ := value.(GcStats)
+	return gcstats, err
+}
+
+//Collector runs every nodetool command concurrently on an interval and publishes a Snapshot after each collection
+type Collector struct {
+	//Data accumulates the history of every collection. It may be configured before Run but must not be used after.
+	Data *Data
+	//Timeout is the deadline for each command, commands that miss it are reported as failing
+	Timeout time.Duration
+	//Done stops Run once it returns true e.g. at the end of a replay, so later ticks do not add duplicate samples
+	Done func() bool
+	//Cluster polls every node in the ring on its own loop while Run is running if set. Each snapshot holds the result
+	//of the latest poll to finish so slow nodes never delay the local stats.
+	Cluster *Cluster
+
+	source        DataSource
+	results       *collectedSource
+	snapshots     chan *Snapshot
+	refresh       chan struct{}
+	clusterStatus chan Status
+	mu            sync.Mutex
+	table         KeyspaceTable
+	clusterStats  []NodeStats
+}
+
+//NewCollector constructs a collector reading from source and keeping up to capacity samples in each timeseries
+func NewCollector(source DataSource, capacity int) *Collector {
+	return NewCollectorWithClock(source, capacity, time.Now)
+}
+
+//NewCollectorWithClock constructs a collector like NewCollector that timestamps samples with the given clock
+func NewCollectorWithClock(source DataSource, capacity int, now func() time.Time) *Collector {
+	results := &collectedSource{results: make(map[string]collected)}
+	return &Collector{
+		Data:          NewDataWithClock(results, capacity, now),
+		Timeout:       30 * time.Second,
+		source:        source,
+		results:       results,
+		snapshots:     make(chan *Snapshot, 1),
+		refresh:       make(chan struct{}, 1),
+		clusterStatus: make(chan Status, 1),
+	}
+}
+
+//Snapshots returns the channel snapshots are published on. Only the latest snapshot is kept if it is not received
+//before the next collection.
+func (c *Collector) Snapshots() <-chan *Snapshot {
+	return c.snapshots
+}
+
+//SelectTable adds the histograms of a table to every collection, an empty keyspace and table stops collecting them
+func (c *Collector) SelectTable(keyspace string, table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.table = KeyspaceTable{Keyspace: keyspace, Table: Table{Name: table}}
+}
+
+//Refresh asks a running collector to collect now rather than waiting for the next interval
+func (c *Collector) Refresh() {
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+//Run collects immediately and then on every interval until the context is cancelled or Done returns true
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if c.Cluster != nil {
+		go c.pollCluster(ctx)
+	}
+
+	for {
+		c.publish(c.Collect(ctx))
+		if c.Done != nil && c.Done() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.refresh:
+		}
+	}
+}
+
+//pollCluster polls the nodes in the most recently collected status until the context is cancelled. A status
+//collected while a poll is running replaces any status still waiting so only the latest ring is polled next.
+func (c *Collector) pollCluster(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-c.clusterStatus:
+			stats := c.Cluster.Poll(status)
+			c.mu.Lock()
+			c.clusterStats = stats
+			c.mu.Unlock()
+		}
+	}
+}
+
+//publish replaces any snapshot that has not been received yet so the receiver only ever sees the latest
+func (c *Collector) publish(snapshot *Snapshot) {
+	select {
+	case <-c.snapshots:
+	default:
+	}
+	c.snapshots <- snapshot
+}
+
+//Collect runs every command concurrently, waits for them to finish or miss their deadline and returns a snapshot of
+//the result
+func (c *Collector) Collect(ctx context.Context) *Snapshot {
+	c.mu.Lock()
+	table := c.table
+	c.mu.Unlock()
+
+	fetches := make(map[string]func(DataSource) (interface{}, error), len(dumpCommands)+1)
+	for command, fetch := range dumpCommands {
+		fetches[command] = fetch
+	}
+	if table.Keyspace != "" {
+		fetches["tablehistograms"] = func(source DataSource) (interface{}, error) {
+			return source.GetTableHistograms(table.Keyspace, table.Name)
+		}
+	}
+
+	results := make(map[string]collected, len(fetches))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for command, fetch := range fetches {
+		wg.Add(1)
+		go func(command string, fetch func(DataSource) (interface{}, error)) {
+			defer wg.Done()
+			result := c.fetch(ctx, command, fetch)
+			mu.Lock()
+			results[command] = result
+			mu.Unlock()
+		}(command, fetch)
+	}
+	wg.Wait()
+	c.results.results = results
+
+	//info is applied first as throughput depends on the generation it reports
+	d := c.Data
+	d.GetInfoMetrics()
+	d.GetPcntNodesUN()
+	d.GetCfMetrics()
+	d.GetProxyMetrics()
+	d.GetGcMetrics()
+	d.GetCompactionMetrics()
+	d.GetTpStats()
+	d.PruneHistory()
+
+	var histograms TableHistograms
+	if table.Keyspace != "" {
+		histograms = d.GetTableHistograms(table.Keyspace, table.Name)
+	} else {
+		//histograms are no longer collected so an old failure no longer applies
+		d.recordResult("tablehistograms", nil)
+	}
+
+	snapshot := d.Snapshot()
+	snapshot.SelectedTable = table
+	snapshot.TableHistograms = histograms
+	if c.Cluster != nil {
+		select {
+		case <-c.clusterStatus:
+		default:
+		}
+		c.clusterStatus <- snapshot.Status
+
+		c.mu.Lock()
+		snapshot.Cluster = c.clusterStats
+		c.mu.Unlock()
+	}
+	return snapshot
+}
+
+//fetch runs a single command giving up once the timeout or the context expires. A command that gives up keeps
+//running in the background until the executor stops it.
+func (c *Collector) fetch(ctx context.Context, command string, fetch func(DataSource) (interface{}, error)) collected {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan collected, 1)
+	go func() {
+		value, err := fetch(c.source)
+		done <- collected{value: value, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return collected{err: fmt.Errorf("nodetool %s: %v", command, ctx.Err())}
+	}
+}
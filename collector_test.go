@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+//delayedExecutor returns fixtures after waiting for the delay configured for the command
+type delayedExecutor struct {
+	fixtures FixtureExecutor
+	delays   map[string]time.Duration
+}
+
+func (e *delayedExecutor) Execute(args ...string) (string, error) {
+	time.Sleep(e.delays[strings.Join(args, " ")])
+	return e.fixtures.Execute(args...)
+}
+
+func TestCollector(t *testing.T) {
+	executor := &delayedExecutor{
+		fixtures: FixtureExecutor{
+			"version": "ReleaseVersion: 2.1.13",
+			"status": `Datacenter: DC1
+==================
+--  Address    Load       Tokens  Owns    Host ID                               Rack
+UN  10.0.0.6   35.32 GB   256     50%     99ca9b90-ba59-4411-be56-aafcabedc9c6  5AB
+DN  10.0.0.7   157.74 GB  256     50%     4da97bcf-9831-438b-863c-8a15a19a904e  5AE`,
+			"info":    "Heap Memory (MB) : 25.00 / 100.00\n    Exceptions       : 3",
+			"tpstats": "Pool Name                    Active   Pending      Completed   Blocked  All time blocked",
+		},
+		delays: map[string]time.Duration{"tpstats": time.Second, "info": 10 * time.Millisecond},
+	}
+
+	collector := NewCollector(NewNodetoolWithExecutor(executor), 10)
+	collector.Timeout = 100 * time.Millisecond
+
+	started := time.Now()
+	first := collector.Collect(context.Background())
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Error("Expected the slow command to be abandoned at its deadline", elapsed)
+	}
+
+	if first.PcntNodesUN != 50 || first.Series["heap_usage"].Last().Value != 25 {
+		t.Error("Snapshot is incorrect", first.PcntNodesUN, first.Series["heap_usage"].Values())
+	}
+	if !first.IsStale("tpstats") || first.IsStale("status") {
+		t.Error("Expected only the slow command to be stale", first.Failures)
+	}
+	if failures := strings.Join(first.Failures, "\n"); !strings.Contains(failures, "tpstats") || !strings.Contains(failures, "deadline exceeded") {
+		t.Error("Expected the deadline to be reported", failures)
+	}
+
+	//snapshots are copies so later collections do not change them
+	collector.Collect(context.Background())
+	if first.Series["heap_usage"].Len() != 2 {
+		t.Error("Expected the published snapshot to be unchanged", first.Series["heap_usage"].Values())
+	}
+
+	//only the latest snapshot is waiting to be received
+	collector.publish(first)
+	collector.publish(&Snapshot{PcntNodesUN: 1})
+	if latest := <-collector.Snapshots(); latest.PcntNodesUN != 1 {
+		t.Error("Expected the latest snapshot", latest.PcntNodesUN)
+	}
+}
+
+func TestCollectorPollsClusterSeparately(t *testing.T) {
+	fixtures := FixtureExecutor{
+		"status": `Datacenter: DC1
+==================
+--  Address    Load       Tokens  Owns    Host ID                               Rack
+UN  10.0.0.6   35.32 GB   256     50%     99ca9b90-ba59-4411-be56-aafcabedc9c6  5AB`,
+	}
+	release := make(chan struct{})
+	collector := NewCollector(NewNodetoolWithExecutor(fixtures), 10)
+	collector.Cluster = &Cluster{
+		NewSource: func(address string) DataSource {
+			<-release
+			return NewNodetoolWithExecutor(FixtureExecutor{"info": "Exceptions       : 7", "cfstats": ""})
+		},
+		Timeout:     5 * time.Second,
+		Parallelism: 1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collector.Run(ctx, 10*time.Millisecond)
+
+	//the local stats are published while the poll is still waiting on the node
+	select {
+	case snapshot := <-collector.Snapshots():
+		if snapshot.PcntNodesUN != 100 || len(snapshot.Cluster) != 0 {
+			t.Error("Expected the local stats without cluster stats", snapshot.PcntNodesUN, snapshot.Cluster)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a snapshot before the cluster poll finished")
+	}
+
+	close(release)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case snapshot := <-collector.Snapshots():
+			if len(snapshot.Cluster) == 1 && snapshot.Cluster[0].Info.Exceptions == 7 {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Expected a later snapshot to hold the cluster stats")
+		}
+	}
+}
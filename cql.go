@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//native protocol v4 opcodes
+const (
+	cqlError         = 0x00
+	cqlStartup       = 0x01
+	cqlReady         = 0x02
+	cqlAuthenticate  = 0x03
+	cqlQuery         = 0x07
+	cqlResult        = 0x08
+	cqlAuthChallenge = 0x0E
+	cqlAuthResponse  = 0x0F
+	cqlAuthSuccess   = 0x10
+)
+
+const (
+	cqlVersion        = 0x04
+	cqlResponse       = 0x80
+	cqlResultRows     = 0x0002
+	cqlConsistencyOne = 0x0001
+	cqlMaxFrameLength = 256 << 20
+)
+
+//cqlRow is a single row of a query result keyed by column name
+type cqlRow map[string]interface{}
+
+func (r cqlRow) str(column string) string {
+	if value, ok := r[column]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+func (r cqlRow) float(column string) float64 {
+	switch v := r[column].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func (r cqlRow) int(column string) int64 {
+	switch v := r[column].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+//CQL reads the system_views virtual tables added in Cassandra 4.0 over the native protocol so neither nodetool nor
+//JMX is needed. Only the connected node is described in detail, other nodes are listed from system.peers but their
+//state is unknown. The virtual tables have no heap, exception or gc metrics and no coordinator histograms.
+type CQL struct {
+	//Address is the host and native transport port e.g. localhost:9042
+	Address  string
+	Username string
+	Password string
+	Timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+//NewCQL constructs a data source querying the node listening on address. Queries running longer than the timeout
+//fail and the connection is re-established on the next query.
+func NewCQL(address string, timeout time.Duration) *CQL {
+	return &CQL{Address: address, Timeout: timeout}
+}
+
+//cqlFrame is a single request or response frame
+type cqlFrame struct {
+	opcode byte
+	body   []byte
+}
+
+func (c *CQL) writeFrame(opcode byte, body []byte) error {
+	header := []byte{cqlVersion, 0, 0, 0, opcode, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[5:], uint32(len(body)))
+	_, err := c.conn.Write(append(header, body...))
+	return err
+}
+
+func (c *CQL) readFrame() (cqlFrame, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return cqlFrame{}, err
+	}
+	if header[0] != cqlVersion|cqlResponse {
+		return cqlFrame{}, fmt.Errorf("unsupported protocol version %#x", header[0])
+	}
+	length := binary.BigEndian.Uint32(header[5:])
+	if length > cqlMaxFrameLength {
+		return cqlFrame{}, fmt.Errorf("frame of %d bytes is too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return cqlFrame{}, err
+	}
+	frame := cqlFrame{opcode: header[4], body: body}
+	if frame.opcode == cqlError {
+		d := &cqlDecoder{buf: body}
+		code := d.int()
+		return frame, fmt.Errorf("error %#x: %s", code, d.string())
+	}
+	return frame, nil
+}
+
+//connect opens a connection and completes the startup and authentication handshake
+func (c *CQL) connect() error {
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	//a server that accepts the connection but never answers would otherwise block every later query
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	e := &cqlEncoder{}
+	e.short(1)
+	e.string("CQL_VERSION")
+	e.string("3.0.0")
+	if err := c.writeFrame(cqlStartup, e.buf); err != nil {
+		return err
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+
+	if frame.opcode == cqlAuthenticate {
+		if c.Username == "" {
+			return errors.New("authentication is required, set a username and password")
+		}
+		//SASL PLAIN as expected by the PasswordAuthenticator
+		e := &cqlEncoder{}
+		e.bytes([]byte("\x00" + c.Username + "\x00" + c.Password))
+		if err := c.writeFrame(cqlAuthResponse, e.buf); err != nil {
+			return err
+		}
+		if frame, err = c.readFrame(); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+		if frame.opcode == cqlAuthChallenge {
+			return errors.New("authentication failed: unsupported authenticator")
+		}
+		if frame.opcode != cqlAuthSuccess {
+			return fmt.Errorf("authentication failed: unexpected opcode %#x", frame.opcode)
+		}
+		return nil
+	}
+	if frame.opcode != cqlReady {
+		return fmt.Errorf("unexpected opcode %#x", frame.opcode)
+	}
+	return nil
+}
+
+//Query runs a single unpaged query and returns every row. Queries are run one at a time on a single connection.
+func (c *CQL) Query(query string) ([]cqlRow, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows, err := c.query(query)
+	if err != nil {
+		//the connection may be part way through a frame so it cannot be reused
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		return nil, fmt.Errorf("cql %s: %v", query, err)
+	}
+	return rows, nil
+}
+
+func (c *CQL) query(query string) ([]cqlRow, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	e := &cqlEncoder{}
+	e.longString(query)
+	e.short(cqlConsistencyOne)
+	e.byte(0)
+	if err := c.writeFrame(cqlQuery, e.buf); err != nil {
+		return nil, err
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if frame.opcode != cqlResult {
+		return nil, fmt.Errorf("unexpected opcode %#x", frame.opcode)
+	}
+	return decodeRows(frame.body)
+}
+
+//cqlEncoder writes the native protocol notations
+type cqlEncoder struct {
+	buf []byte
+}
+
+func (e *cqlEncoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *cqlEncoder) short(n uint16) {
+	e.buf = append(e.buf, byte(n>>8), byte(n))
+}
+
+func (e *cqlEncoder) int(n int32) {
+	e.buf = append(e.buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func (e *cqlEncoder) string(s string) {
+	e.short(uint16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cqlEncoder) longString(s string) {
+	e.int(int32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cqlEncoder) bytes(b []byte) {
+	if b == nil {
+		e.int(-1)
+		return
+	}
+	e.int(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+//cqlDecoder reads the native protocol notations. Reading past the end sets err and returns zero values.
+type cqlDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *cqlDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *cqlDecoder) short() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *cqlDecoder) int() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *cqlDecoder) string() string {
+	return string(d.next(int(d.short())))
+}
+
+//bytes returns nil for a null value
+func (d *cqlDecoder) bytes() []byte {
+	n := d.int()
+	if n < 0 || d.err != nil {
+		return nil
+	}
+	if n == 0 {
+		return []byte{}
+	}
+	return d.next(int(n))
+}
+
+//cqlType is a column type, collections have the types of their elements
+type cqlType struct {
+	id       uint16
+	elements []cqlType
+}
+
+func (d *cqlDecoder) option() cqlType {
+	t := cqlType{id: d.short()}
+	switch t.id {
+	case 0x0000:
+		d.string()
+	case 0x0020, 0x0022:
+		t.elements = []cqlType{d.option()}
+	case 0x0021:
+		t.elements = []cqlType{d.option(), d.option()}
+	case 0x0030:
+		d.string()
+		d.string()
+		for n := d.short(); n > 0 && d.err == nil; n-- {
+			d.string()
+			t.elements = append(t.elements, d.option())
+		}
+	case 0x0031:
+		for n := d.short(); n > 0 && d.err == nil; n-- {
+			t.elements = append(t.elements, d.option())
+		}
+	}
+	return t
+}
+
+//decodeRows decodes a result frame body. Results other than rows e.g. from a USE have no rows.
+func decodeRows(body []byte) ([]cqlRow, error) {
+	d := &cqlDecoder{buf: body}
+	if d.int() != cqlResultRows {
+		return []cqlRow{}, d.err
+	}
+
+	flags := d.int()
+	//each column takes at least 4 bytes of metadata so a count the frame cannot hold is malformed
+	n := d.int()
+	if n < 0 || int(n) > len(d.buf)/4 {
+		return nil, fmt.Errorf("invalid column count %d", n)
+	}
+	columns := make([]string, n)
+	types := make([]cqlType, len(columns))
+	if flags&0x0002 != 0 {
+		d.bytes()
+	}
+	if flags&0x0004 != 0 {
+		return nil, errors.New("result has no metadata")
+	}
+	global := flags&0x0001 != 0
+	if global {
+		d.string()
+		d.string()
+	}
+	for i := range columns {
+		if !global {
+			d.string()
+			d.string()
+		}
+		columns[i] = d.string()
+		types[i] = d.option()
+	}
+
+	//each value takes at least 4 bytes, rows are assumed to take at least 1 byte so the count is always bounded
+	count := d.int()
+	rowSize := max(4*len(columns), 1)
+	if count < 0 || int(count) > len(d.buf)/rowSize {
+		return nil, fmt.Errorf("invalid row count %d", count)
+	}
+	rows := make([]cqlRow, 0, count)
+	for i := int32(0); i < count && d.err == nil; i++ {
+		row := make(cqlRow, len(columns))
+		for j, column := range columns {
+			if value := d.bytes(); value != nil {
+				row[column] = decodeValue(types[j], value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, d.err
+}
+
+//decodeValue converts a serialized value to a string, int64, float64, bool, time, slice or map. Types the virtual
+//tables do not use are returned as raw bytes.
+func decodeValue(t cqlType, value []byte) interface{} {
+	switch t.id {
+	case 0x0001, 0x000A, 0x000D:
+		return string(value)
+	case 0x0002, 0x0005, 0x0009, 0x0013, 0x0014:
+		//bigint, counter, int, smallint and tinyint are sign extended
+		n := int64(0)
+		for i, b := range value {
+			if i == 0 {
+				n = int64(int8(b))
+				continue
+			}
+			n = n<<8 | int64(b)
+		}
+		return n
+	case 0x0004:
+		return len(value) > 0 && value[0] != 0
+	case 0x0007:
+		if len(value) == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(value))
+		}
+	case 0x0008:
+		if len(value) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(value)))
+		}
+	case 0x000B:
+		if len(value) == 8 {
+			ms := int64(binary.BigEndian.Uint64(value))
+			return time.Unix(0, ms*int64(time.Millisecond))
+		}
+	case 0x000C, 0x000F:
+		if len(value) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", value[0:4], value[4:6], value[6:8], value[8:10], value[10:16])
+		}
+	case 0x0010:
+		return net.IP(value).String()
+	case 0x0020, 0x0022:
+		d := &cqlDecoder{buf: value}
+		elements := make([]interface{}, 0)
+		for n := d.int(); n > 0 && d.err == nil; n-- {
+			elements = append(elements, decodeValue(t.elements[0], d.bytes()))
+		}
+		return elements
+	case 0x0021:
+		d := &cqlDecoder{buf: value}
+		entries := make(map[string]interface{})
+		for n := d.int(); n > 0 && d.err == nil; n-- {
+			key := decodeValue(t.elements[0], d.bytes())
+			entries[fmt.Sprint(key)] = decodeValue(t.elements[1], d.bytes())
+		}
+		return entries
+	}
+	return value
+}
+
+//tableKey identifies a table in the per table virtual tables
+type tableKey struct {
+	keyspace string
+	table    string
+}
+
+//tableRows indexes rows by keyspace and table
+func tableRows(rows []cqlRow) map[tableKey]cqlRow {
+	tables := make(map[tableKey]cqlRow, len(rows))
+	for _, row := range rows {
+		tables[tableKey{keyspace: row.str("keyspace_name"), table: row.str("table_name")}] = row
+	}
+	return tables
+}
+
+//queryAll runs several queries returning the rows of each in order
+func (c *CQL) queryAll(queries ...string) ([][]cqlRow, error) {
+	results := make([][]cqlRow, len(queries))
+	for i, query := range queries {
+		rows, err := c.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = rows
+	}
+	return results, nil
+}
+
+//localLoad is the disk space used by every table on the connected node
+func localLoad(diskUsage []cqlRow) int64 {
+	load := int64(0)
+	for _, row := range diskUsage {
+		load += row.int("mebibytes") << 20
+	}
+	return load
+}
+
+//GetStatus lists the connected node and its peers. The connected node must be up, the state of peers is unknown.
+func (c *CQL) GetStatus() (Status, error) {
+	results, err := c.queryAll(
+		"SELECT broadcast_address, data_center, rack, host_id, tokens FROM system.local",
+		"SELECT peer, data_center, rack, host_id, tokens FROM system.peers",
+		"SELECT mebibytes FROM system_views.disk_usage",
+	)
+	if err != nil {
+		return Status{}, err
+	}
+
+	datacenters := make(map[string]*Datacenter)
+	add := func(row cqlRow, address string, state string) *Node {
+		tokens, _ := row["tokens"].([]interface{})
+		node := Node{State: state, Address: address, Load: "?", Tokens: fmt.Sprint(len(tokens)), Owns: "?", HostID: row.str("host_id"), Rack: row.str("rack")}
+		dc, ok := datacenters[row.str("data_center")]
+		if !ok {
+			dc = &Datacenter{Name: row.str("data_center"), Nodes: make([]Node, 0)}
+			datacenters[dc.Name] = dc
+		}
+		dc.Nodes = append(dc.Nodes, node)
+		return &dc.Nodes[len(dc.Nodes)-1]
+	}
+	for _, row := range results[0] {
+		node := add(row, row.str("broadcast_address"), "UN")
+		node.LoadBytes = localLoad(results[2])
+		node.Load = FormatBytes(node.LoadBytes)
+	}
+	for _, row := range results[1] {
+		add(row, row.str("peer"), "?N")
+	}
+
+	status := Status{Datacenters: make([]Datacenter, 0, len(datacenters))}
+	for _, dc := range datacenters {
+		sort.Slice(dc.Nodes, func(a, b int) bool { return dc.Nodes[a].Address < dc.Nodes[b].Address })
+		status.Datacenters = append(status.Datacenters, *dc)
+	}
+	sort.Slice(status.Datacenters, func(a, b int) bool { return status.Datacenters[a].Name < status.Datacenters[b].Name })
+	return status, nil
+}
+
+//GetInfo describes the connected node and its caches. Heap, uptime and exceptions are not available.
+func (c *CQL) GetInfo() (Info, error) {
+	results, err := c.queryAll(
+		"SELECT host_id, data_center, rack, gossip_generation FROM system.local",
+		"SELECT mebibytes FROM system_views.disk_usage",
+		"SELECT name, capacity_bytes, entry_count, hit_count, hit_ratio, request_count, size_bytes FROM system_views.caches",
+	)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(results[0]) != 1 {
+		return Info{}, errors.New("cql: system.local is empty")
+	}
+
+	local := results[0][0]
+	info := Info{
+		ID:                    local.str("host_id"),
+		NativeTransportActive: true,
+		LoadBytes:             localLoad(results[1]),
+		GenerationNo:          local.int("gossip_generation"),
+		DataCenter:            local.str("data_center"),
+		Rack:                  local.str("rack"),
+	}
+	info.Load = FormatBytes(info.LoadBytes)
+
+	caches := map[string]*Cache{"keys": &info.KeyCache, "rows": &info.RowCache, "counters": &info.CounterCache, "chunks": &info.ChunkCache}
+	for _, row := range results[2] {
+		cache, ok := caches[row.str("name")]
+		if !ok {
+			continue
+		}
+		*cache = Cache{
+			Entries:       row.int("entry_count"),
+			SizeBytes:     row.int("size_bytes"),
+			CapacityBytes: row.int("capacity_bytes"),
+			Hits:          row.int("hit_count"),
+			Requests:      row.int("request_count"),
+			Misses:        row.int("request_count") - row.int("hit_count"),
+			RecentHitRate: row.float("hit_ratio"),
+		}
+		cache.Size, cache.Capacity = FormatBytes(cache.SizeBytes), FormatBytes(cache.CapacityBytes)
+	}
+	return info, nil
+}
+
+//GetCfStats builds the table stats from the per table virtual tables. Latencies are the median as the virtual tables
+//have no mean.
+func (c *CQL) GetCfStats() (CfStats, error) {
+	results, err := c.queryAll(
+		"SELECT keyspace_name, table_name, count, p50th_ms FROM system_views.local_read_latency",
+		"SELECT keyspace_name, table_name, count, p50th_ms FROM system_views.local_write_latency",
+		"SELECT keyspace_name, table_name, mebibytes FROM system_views.disk_usage",
+		"SELECT keyspace_name, table_name, mebibytes FROM system_views.max_partition_size",
+		"SELECT keyspace_name, table_name, median, max FROM system_views.tombstones_per_read",
+		"SELECT keyspace_name, table_name, median, max FROM system_views.rows_per_read",
+	)
+	if err != nil {
+		return CfStats{}, err
+	}
+	reads, writes := tableRows(results[0]), tableRows(results[1])
+	diskUsage, partitions := tableRows(results[2]), tableRows(results[3])
+	tombstones, cells := tableRows(results[4]), tableRows(results[5])
+
+	byKeyspace := make(map[string]*Keyspace)
+	for key, read := range reads {
+		write := writes[key]
+		table := Table{
+			Name:                  key.table,
+			LocalReadCount:        read.int("count"),
+			LocalReadLatency:      read.float("p50th_ms"),
+			LocalWriteCount:       write.int("count"),
+			LocalWriteLatency:     write.float("p50th_ms"),
+			SpaceUsedLive:         diskUsage[key].int("mebibytes") << 20,
+			PartitionMaxBytes:     partitions[key].int("mebibytes") << 20,
+			AvgTombstonesPerSlice: tombstones[key].float("median"),
+			MaxTombstonesPerSlice: tombstones[key].float("max"),
+			AvgLiveCellsPerSlice:  cells[key].float("median"),
+			MaxLiveCellsPerSlice:  cells[key].float("max"),
+		}
+		table.SpaceUsedTotal = table.SpaceUsedLive
+
+		keyspace, ok := byKeyspace[key.keyspace]
+		if !ok {
+			keyspace = &Keyspace{Name: key.keyspace, Tables: make([]Table, 0)}
+			byKeyspace[key.keyspace] = keyspace
+		}
+		keyspace.Tables = append(keyspace.Tables, table)
+	}
+
+	cfstats := CfStats{Keyspaces: make([]Keyspace, 0, len(byKeyspace))}
+	for _, keyspace := range byKeyspace {
+		readTotal, writeTotal := 0.0, 0.0
+		for _, table := range keyspace.Tables {
+			keyspace.ReadCount += table.LocalReadCount
+			keyspace.WriteCount += table.LocalWriteCount
+			readTotal += table.LocalReadLatency * float64(table.LocalReadCount)
+			writeTotal += table.LocalWriteLatency * float64(table.LocalWriteCount)
+		}
+		if keyspace.ReadCount > 0 {
+			keyspace.ReadLatency = readTotal / float64(keyspace.ReadCount)
+		}
+		if keyspace.WriteCount > 0 {
+			keyspace.WriteLatency = writeTotal / float64(keyspace.WriteCount)
+		}
+		sort.Slice(keyspace.Tables, func(a, b int) bool { return keyspace.Tables[a].Name < keyspace.Tables[b].Name })
+		cfstats.Keyspaces = append(cfstats.Keyspaces, *keyspace)
+	}
+	sort.Slice(cfstats.Keyspaces, func(a, b int) bool { return cfstats.Keyspaces[a].Name < cfstats.Keyspaces[b].Name })
+	return cfstats, nil
+}
+
+//GetTpStats reads the thread pools. Dropped messages are not available.
+func (c *CQL) GetTpStats() (TpStats, error) {
+	rows, err := c.Query("SELECT name, active_tasks, pending_tasks, completed_tasks, blocked_tasks, blocked_tasks_all_time FROM system_views.thread_pools")
+	if err != nil {
+		return TpStats{}, err
+	}
+	tpstats := TpStats{ThreadPools: make([]ThreadPool, 0, len(rows)), DroppedMessages: make([]DroppedMessage, 0)}
+	for _, row := range rows {
+		tpstats.ThreadPools = append(tpstats.ThreadPools, ThreadPool{
+			Name:           row.str("name"),
+			Active:         row.int("active_tasks"),
+			Pending:        row.int("pending_tasks"),
+			Completed:      row.int("completed_tasks"),
+			Blocked:        row.int("blocked_tasks"),
+			AllTimeBlocked: row.int("blocked_tasks_all_time"),
+		})
+	}
+	sort.Slice(tpstats.ThreadPools, func(a, b int) bool { return tpstats.ThreadPools[a].Name < tpstats.ThreadPools[b].Name })
+	return tpstats, nil
+}
+
+//GetCompactionStats lists the running sstable tasks. The number of pending tasks is not available.
+func (c *CQL) GetCompactionStats() (CompactionStats, error) {
+	rows, err := c.Query("SELECT keyspace_name, table_name, task_id, kind, progress, total, unit FROM system_views.sstable_tasks")
+	if err != nil {
+		return CompactionStats{}, err
+	}
+	stats := CompactionStats{Compactions: make([]Compaction, 0, len(rows))}
+	for _, row := range rows {
+		compaction := Compaction{
+			ID:        row.str("task_id"),
+			Type:      row.str("kind"),
+			Keyspace:  row.str("keyspace_name"),
+			Table:     row.str("table_name"),
+			Completed: row.int("progress"),
+			Total:     row.int("total"),
+			Unit:      row.str("unit"),
+		}
+		if compaction.Total > 0 {
+			compaction.Progress = float64(compaction.Completed) / float64(compaction.Total) * 100
+		}
+		stats.Compactions = append(stats.Compactions, compaction)
+	}
+	return stats, nil
+}
+
+//GetProxyHistograms is not supported as coordinator latencies are only available per table
+func (c *CQL) GetProxyHistograms() (ProxyHistograms, error) {
+	return ProxyHistograms{}, ErrUnsupported
+}
+
+//GetTableHistograms reads the latency percentiles and maximum partition size of a table. Latencies are converted to
+//microseconds to match nodetool.
+func (c *CQL) GetTableHistograms(keyspace string, table string) (TableHistograms, error) {
+	where := fmt.Sprintf(" WHERE keyspace_name = '%s' AND table_name = '%s'", strings.Replace(keyspace, "'", "''", -1), strings.Replace(table, "'", "''", -1))
+	results, err := c.queryAll(
+		"SELECT p50th_ms, p99th_ms, max_ms FROM system_views.local_read_latency"+where,
+		"SELECT p50th_ms, p99th_ms, max_ms FROM system_views.local_write_latency"+where,
+		"SELECT mebibytes FROM system_views.max_partition_size"+where,
+	)
+	if err != nil {
+		return TableHistograms{}, err
+	}
+
+	histograms := TableHistograms{}
+	for i, percentiles := range []*Percentiles{&histograms.ReadLatency, &histograms.WriteLatency} {
+		for _, row := range results[i] {
+			percentiles.P50 = row.float("p50th_ms") * 1000
+			percentiles.P99 = row.float("p99th_ms") * 1000
+			percentiles.Max = row.float("max_ms") * 1000
+		}
+	}
+	for _, row := range results[2] {
+		histograms.PartitionSize.Max = float64(row.int("mebibytes") << 20)
+	}
+	return histograms, nil
+}
+
+//GetGcStats is not supported as the virtual tables have no gc metrics
+func (c *CQL) GetGcStats() (GcStats, error) {
+	return GcStats{}, ErrUnsupported
+}
+
+//Close closes the connection if one is open
+func (c *CQL) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
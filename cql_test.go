@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+//cqlColumn describes a column of a fake result
+type cqlColumn struct {
+	name string
+	typ  cqlType
+}
+
+var (
+	cqlText    = cqlType{id: 0x000D}
+	cqlBigint  = cqlType{id: 0x0002}
+	cqlInt     = cqlType{id: 0x0009}
+	cqlDouble  = cqlType{id: 0x0007}
+	cqlUUID    = cqlType{id: 0x000C}
+	cqlInet    = cqlType{id: 0x0010}
+	cqlTextSet = cqlType{id: 0x0022, elements: []cqlType{cqlText}}
+)
+
+//cqlResultSet is the canned result of a query
+type cqlResultSet struct {
+	columns []cqlColumn
+	rows    [][]interface{}
+}
+
+//fakeCQLServer answers queries with canned results over the native protocol. It requires a password if one is set.
+type fakeCQLServer struct {
+	listener net.Listener
+	username string
+	password string
+	results  map[string]cqlResultSet
+}
+
+func newFakeCQLServer(t *testing.T, results map[string]cqlResultSet) *fakeCQLServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeCQLServer{listener: listener, results: results}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeCQLServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		header := make([]byte, 9)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[5:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		e := &cqlEncoder{}
+		opcode := byte(cqlError)
+		d := &cqlDecoder{buf: body}
+		switch header[4] {
+		case cqlStartup:
+			opcode = cqlReady
+			if s.password != "" {
+				opcode = cqlAuthenticate
+				e.string("org.apache.cassandra.auth.PasswordAuthenticator")
+			}
+		case cqlAuthResponse:
+			if string(d.bytes()) == "\x00"+s.username+"\x00"+s.password {
+				opcode = cqlAuthSuccess
+				e.bytes(nil)
+			} else {
+				e.int(0x0100)
+				e.string("Provided username and/or password are incorrect")
+			}
+		case cqlQuery:
+			query := string(d.next(int(d.int())))
+			if result, ok := s.results[query]; ok {
+				opcode = cqlResult
+				encodeRows(e, result)
+			} else {
+				e.int(0x2200)
+				e.string("unknown query " + query)
+			}
+		}
+
+		response := []byte{cqlVersion | cqlResponse, 0, header[2], header[3], opcode, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(response[5:], uint32(len(e.buf)))
+		if _, err := conn.Write(append(response, e.buf...)); err != nil {
+			return
+		}
+	}
+}
+
+func encodeRows(e *cqlEncoder, result cqlResultSet) {
+	e.int(cqlResultRows)
+	e.int(0x0001)
+	e.int(int32(len(result.columns)))
+	e.string("system_views")
+	e.string("fake")
+	for _, column := range result.columns {
+		e.string(column.name)
+		e.short(column.typ.id)
+		for _, element := range column.typ.elements {
+			e.short(element.id)
+		}
+	}
+	e.int(int32(len(result.rows)))
+	for _, row := range result.rows {
+		for i, value := range row {
+			e.bytes(encodeValue(result.columns[i].typ, value))
+		}
+	}
+}
+
+func encodeValue(t cqlType, value interface{}) []byte {
+	if value == nil {
+		return nil
+	}
+	switch t.id {
+	case cqlBigint.id:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(int64(value.(int))))
+		return b
+	case cqlInt.id:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(value.(int))))
+		return b
+	case cqlDouble.id:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(value.(float64)))
+		return b
+	case cqlUUID.id:
+		uuid, _ := hex.DecodeString(strings.Replace(value.(string), "-", "", -1))
+		return uuid
+	case cqlInet.id:
+		return net.ParseIP(value.(string)).To4()
+	case cqlTextSet.id:
+		e := &cqlEncoder{}
+		e.int(int32(len(value.([]string))))
+		for _, element := range value.([]string) {
+			e.bytes([]byte(element))
+		}
+		return e.buf
+	}
+	return []byte(value.(string))
+}
+
+func TestCQL(t *testing.T) {
+	latency := []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"count", cqlBigint}, {"p50th_ms", cqlDouble}}
+	percentiles := []cqlColumn{{"p50th_ms", cqlDouble}, {"p99th_ms", cqlDouble}, {"max_ms", cqlDouble}}
+	server := newFakeCQLServer(t, map[string]cqlResultSet{
+		"SELECT broadcast_address, data_center, rack, host_id, tokens FROM system.local": {
+			columns: []cqlColumn{{"broadcast_address", cqlInet}, {"data_center", cqlText}, {"rack", cqlText}, {"host_id", cqlText}, {"tokens", cqlTextSet}},
+			rows:    [][]interface{}{{"10.0.0.1", "dc1", "r1", "host-1", []string{"-100", "100"}}},
+		},
+		"SELECT peer, data_center, rack, host_id, tokens FROM system.peers": {
+			columns: []cqlColumn{{"peer", cqlInet}, {"data_center", cqlText}, {"rack", cqlText}, {"host_id", cqlText}, {"tokens", cqlTextSet}},
+			rows:    [][]interface{}{{"10.0.0.2", "dc1", "r2", "host-2", []string{"0"}}, {"10.0.0.3", "dc2", "r1", nil, nil}},
+		},
+		"SELECT mebibytes FROM system_views.disk_usage": {
+			columns: []cqlColumn{{"mebibytes", cqlBigint}},
+			rows:    [][]interface{}{{1024}, {512}},
+		},
+		"SELECT host_id, data_center, rack, gossip_generation FROM system.local": {
+			columns: []cqlColumn{{"host_id", cqlUUID}, {"data_center", cqlText}, {"rack", cqlText}, {"gossip_generation", cqlInt}},
+			rows:    [][]interface{}{{"3f1b3a52-8c4e-4a0b-9a4e-1c1f0d2e3a4b", "dc1", "r1", 1697024311}},
+		},
+		"SELECT name, capacity_bytes, entry_count, hit_count, hit_ratio, request_count, size_bytes FROM system_views.caches": {
+			columns: []cqlColumn{{"name", cqlText}, {"capacity_bytes", cqlBigint}, {"entry_count", cqlInt}, {"hit_count", cqlBigint}, {"hit_ratio", cqlDouble}, {"request_count", cqlBigint}, {"size_bytes", cqlBigint}},
+			rows:    [][]interface{}{{"keys", 100 << 20, 98231, 920, 0.92, 1000, 2048}, {"rows", 0, 0, 0, math.NaN(), 0, 0}},
+		},
+		"SELECT keyspace_name, table_name, count, p50th_ms FROM system_views.local_read_latency": {
+			columns: latency,
+			rows:    [][]interface{}{{"ks1", "users", 300, 2.0}, {"ks1", "events", 100, 6.0}, {"ks2", "items", 0, 0.0}},
+		},
+		"SELECT keyspace_name, table_name, count, p50th_ms FROM system_views.local_write_latency": {
+			columns: latency,
+			rows:    [][]interface{}{{"ks1", "users", 10, 0.5}, {"ks1", "events", 0, 0.0}, {"ks2", "items", 0, 0.0}},
+		},
+		"SELECT keyspace_name, table_name, mebibytes FROM system_views.disk_usage": {
+			columns: []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"mebibytes", cqlBigint}},
+			rows:    [][]interface{}{{"ks1", "users", 1024}},
+		},
+		"SELECT keyspace_name, table_name, mebibytes FROM system_views.max_partition_size": {
+			columns: []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"mebibytes", cqlBigint}},
+			rows:    [][]interface{}{{"ks1", "users", 2}},
+		},
+		"SELECT keyspace_name, table_name, median, max FROM system_views.tombstones_per_read": {
+			columns: []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"median", cqlDouble}, {"max", cqlDouble}},
+			rows:    [][]interface{}{{"ks1", "users", 1.5, 12.0}},
+		},
+		"SELECT keyspace_name, table_name, median, max FROM system_views.rows_per_read": {
+			columns: []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"median", cqlDouble}, {"max", cqlDouble}},
+			rows:    [][]interface{}{},
+		},
+		"SELECT name, active_tasks, pending_tasks, completed_tasks, blocked_tasks, blocked_tasks_all_time FROM system_views.thread_pools": {
+			columns: []cqlColumn{{"name", cqlText}, {"active_tasks", cqlInt}, {"pending_tasks", cqlInt}, {"completed_tasks", cqlBigint}, {"blocked_tasks", cqlBigint}, {"blocked_tasks_all_time", cqlBigint}},
+			rows:    [][]interface{}{{"ReadStage", 0, 0, 500, 0, 3}, {"MutationStage", 2, 40, 1000, 0, 0}},
+		},
+		"SELECT keyspace_name, table_name, task_id, kind, progress, total, unit FROM system_views.sstable_tasks": {
+			columns: []cqlColumn{{"keyspace_name", cqlText}, {"table_name", cqlText}, {"task_id", cqlUUID}, {"kind", cqlText}, {"progress", cqlBigint}, {"total", cqlBigint}, {"unit", cqlText}},
+			rows:    [][]interface{}{{"ks1", "users", "ee2b6e90-68a1-11ee-9f0c-31b0e9a2c7d4", "compaction", 1 << 30, 4 << 30, "bytes"}},
+		},
+		"SELECT p50th_ms, p99th_ms, max_ms FROM system_views.local_read_latency WHERE keyspace_name = 'ks1' AND table_name = 'users'": {
+			columns: percentiles,
+			rows:    [][]interface{}{{2.0, 9.5, 20.0}},
+		},
+		"SELECT p50th_ms, p99th_ms, max_ms FROM system_views.local_write_latency WHERE keyspace_name = 'ks1' AND table_name = 'users'": {
+			columns: percentiles,
+			rows:    [][]interface{}{{0.5, 1.0, 2.0}},
+		},
+		"SELECT mebibytes FROM system_views.max_partition_size WHERE keyspace_name = 'ks1' AND table_name = 'users'": {
+			columns: []cqlColumn{{"mebibytes", cqlBigint}},
+			rows:    [][]interface{}{{2}},
+		},
+	})
+	server.username, server.password = "ntdash", "secret"
+	defer server.listener.Close()
+
+	//a wrong password fails every command
+	source := NewCQL(server.listener.Addr().String(), time.Second)
+	source.Username, source.Password = "ntdash", "wrong"
+	if _, err := source.GetTpStats(); err == nil || !strings.Contains(err.Error(), "incorrect") {
+		t.Error("Expected authentication to fail", err)
+	}
+
+	source.Password = "secret"
+	defer source.Close()
+
+	status, err := source.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Datacenters) != 2 || len(status.Datacenters[0].Nodes) != 2 {
+		t.Fatal("Status datacenters are incorrect", status)
+	}
+	if node := status.Datacenters[0].Nodes[0]; node.State != "UN" || node.Address != "10.0.0.1" || node.LoadBytes != 1536<<20 || node.Tokens != "2" || node.HostID != "host-1" {
+		t.Error("Expected the connected node to be up with its load", node)
+	}
+	if node := status.Datacenters[1].Nodes[0]; node.State != "?N" || node.Load != "?" || node.Tokens != "0" {
+		t.Error("Expected a peer in an unknown state", node)
+	}
+	//peers in an unknown state are not counted as down so a healthy cluster is fully up
+	if pcnt := status.GetPcntUpNormal(); pcnt != 100 {
+		t.Error("Expected peers in an unknown state to be left out of the UN percentage", pcnt)
+	}
+	metrics := &bytes.Buffer{}
+	exporter := NewExporter(source, time.Second)
+	exporter.Refresh()
+	exporter.metrics().WriteTo(metrics)
+	if strings.Count(metrics.String(), "cassandra_node_up{") != 1 {
+		t.Error("Expected only the connected node to report whether it is up", metrics.String())
+	}
+	if strings.Contains(metrics.String(), `command="gcstats"`) || strings.Contains(metrics.String(), "cassandra_gc_") {
+		t.Error("Expected unsupported commands to be left out of the metrics", metrics.String())
+	}
+
+	info, err := source.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "3f1b3a52-8c4e-4a0b-9a4e-1c1f0d2e3a4b" || info.GenerationNo != 1697024311 || info.LoadBytes != 1536<<20 || info.DataCenter != "dc1" {
+		t.Error("Info is incorrect", info)
+	}
+	if info.KeyCache.Entries != 98231 || info.KeyCache.Size != "2.00 KB" || info.KeyCache.Misses != 80 || info.KeyCache.RecentHitRate != 0.92 || !math.IsNaN(info.RowCache.RecentHitRate) {
+		t.Error("Caches are incorrect", info.KeyCache, info.RowCache)
+	}
+
+	cfstats, err := source.GetCfStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfstats.Keyspaces) != 2 || cfstats.Keyspaces[0].Name != "ks1" || len(cfstats.Keyspaces[0].Tables) != 2 {
+		t.Fatal("Keyspaces are incorrect", cfstats)
+	}
+	if keyspace := cfstats.Keyspaces[0]; keyspace.ReadCount != 400 || keyspace.ReadLatency != 3 || keyspace.WriteCount != 10 || keyspace.WriteLatency != 0.5 {
+		t.Error("Expected the keyspace latency to be weighted by requests", keyspace.ReadCount, keyspace.ReadLatency, keyspace.WriteLatency)
+	}
+	if table := cfstats.Keyspaces[0].Tables[1]; table.Name != "users" || table.SpaceUsedLive != 1<<30 || table.PartitionMaxBytes != 2<<20 || table.AvgTombstonesPerSlice != 1.5 {
+		t.Error("Table is incorrect", table)
+	}
+
+	tpstats, err := source.GetTpStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpstats.ThreadPools) != 2 || tpstats.ThreadPools[0].Name != "MutationStage" || tpstats.ThreadPools[0].Pending != 40 || tpstats.ThreadPools[1].AllTimeBlocked != 3 {
+		t.Error("Thread pools are incorrect", tpstats.ThreadPools)
+	}
+
+	compactions, err := source.GetCompactionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compactions.Compactions) != 1 || compactions.Compactions[0].ID != "ee2b6e90-68a1-11ee-9f0c-31b0e9a2c7d4" || compactions.Compactions[0].Progress != 25 {
+		t.Error("Compactions are incorrect", compactions)
+	}
+
+	histograms, err := source.GetTableHistograms("ks1", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if histograms.ReadLatency.P99 != 9500 || histograms.WriteLatency.Max != 2000 || histograms.PartitionSize.Max != 2<<20 {
+		t.Error("Expected latencies in microseconds", histograms)
+	}
+
+	//commands without a virtual table are not failures
+	data := NewData(source)
+	data.GetGcMetrics()
+	data.GetProxyMetrics()
+	if data.IsStale("gcstats") || data.IsStale("proxyhistograms") {
+		t.Error("Expected unsupported commands not to be stale", data.GetFailures())
+	}
+}
+
+func TestCQLHandshakeTimeout(t *testing.T) {
+	//the server accepts connections but never answers the startup
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	source := NewCQL(listener.Addr().String(), 50*time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.Query("SELECT * FROM system.local")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the handshake to time out")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the handshake to give up after the timeout")
+	}
+}
+
+func TestDecodeRowsRejectsInvalidCounts(t *testing.T) {
+	for name, count := range map[string]int32{"negative": -1, "huge": math.MaxInt32} {
+		e := &cqlEncoder{}
+		e.int(cqlResultRows)
+		e.int(0x0001)
+		e.int(count)
+		if _, err := decodeRows(e.buf); err == nil {
+			t.Errorf("Expected a %s column count to be rejected", name)
+		}
+
+		e = &cqlEncoder{}
+		encodeRows(e, cqlResultSet{columns: []cqlColumn{{"name", cqlText}}})
+		e.buf = e.buf[:len(e.buf)-4]
+		e.int(count)
+		if _, err := decodeRows(e.buf); err == nil {
+			t.Errorf("Expected a %s row count to be rejected", name)
+		}
+	}
+}
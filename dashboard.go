@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui"
+	tm "github.com/nsf/termbox-go"
+)
+
+//dashboard owns every widget and all of the UI state. It is only used from the goroutine calling run so nothing in
+//it needs locking, the collector hands it snapshots over a channel instead.
+type dashboard struct {
+	collector   *Collector
+	snapshot    *Snapshot
+	clusterMode bool
+	replayer    *ReplayExecutor
+	replaySpeed float64
+
+	body *ui.Grid
+	//render draws the body to the terminal, replaced in tests as there is no terminal
+	render func()
+
+	title              *ui.Par
+	errorStatus        *ui.Par
+	numUpNodes         *ui.Gauge
+	exceptions         *ui.LineChart
+	heapUsage          *ui.LineChart
+	gcPause            *ui.LineChart
+	gcCollections      *ui.LineChart
+	readLatency        *ui.LineChart
+	writeLatency       *ui.LineChart
+	readRate           *ui.LineChart
+	writeRate          *ui.LineChart
+	keyspaceReads      *ui.BarChart
+	keyspaceWrites     *ui.BarChart
+	dcLoad             *ui.BarChart
+	pendingCompactions *ui.LineChart
+	compactionGauges   []*ui.Gauge
+	threadPools        *ui.List
+	tables             *ui.List
+	cluster            *ui.List
+	nodes              *ui.List
+
+	//histograms of the table selected in the table view
+	tableReadLatency  *ui.BarChart
+	tableWriteLatency *ui.BarChart
+	partitionSize     *ui.BarChart
+	cellCount         *ui.BarChart
+	sstablesPerRead   *ui.BarChart
+	selectedTable     KeyspaceTable
+
+	views       map[string][]*ui.Row
+	currentView string
+
+	//list view state
+	tableSortIdx int
+	nodeSortIdx  int
+	scroll       int
+	tableScroll  int
+
+	//latency charts show the mean from cfstats or a percentile from proxyhistograms
+	latencyIdx      int
+	latencyKeyspace string
+}
+
+func newLineChart(color ui.Attribute, height int) *ui.LineChart {
+	chart := ui.NewLineChart()
+	chart.Data = []float64{0}
+	chart.Height = height
+	chart.AxesColor = ui.ColorWhite
+	chart.LineColor = color
+	return chart
+}
+
+func newBarChart(color ui.Attribute, height int, barWidth int, label string) *ui.BarChart {
+	chart := ui.NewBarChart()
+	chart.Height = height
+	chart.BarWidth = barWidth
+	chart.BarColor = color
+	chart.Border.Label = label
+	return chart
+}
+
+//newDashboard constructs a dashboard showing the given snapshot until the collector publishes another
+func newDashboard(collector *Collector, snapshot *Snapshot, width int, height int) *dashboard {
+	d := &dashboard{collector: collector, snapshot: snapshot, currentView: "dashboard"}
+
+	d.title = ui.NewPar("")
+	d.title.Height = 3
+
+	d.errorStatus = ui.NewPar("")
+	d.errorStatus.Height = 5
+	d.errorStatus.Border.Label = "Errors"
+
+	d.numUpNodes = ui.NewGauge()
+	d.numUpNodes.Percent = 0
+	d.numUpNodes.Height = 3
+	d.numUpNodes.Border.Label = "Num UN Nodes"
+	d.numUpNodes.BarColor = ui.ColorGreen
+	d.numUpNodes.BgColor = ui.ColorRed
+
+	d.exceptions = newLineChart(ui.ColorRed, 8)
+	d.heapUsage = newLineChart(ui.ColorGreen, 8)
+	d.gcPause = newLineChart(ui.ColorYellow, 8)
+	d.gcCollections = newLineChart(ui.ColorYellow, 8)
+	d.readLatency = newLineChart(ui.ColorGreen, 8)
+	d.writeLatency = newLineChart(ui.ColorGreen, 8)
+	d.readRate = newLineChart(ui.ColorCyan, 8)
+	d.writeRate = newLineChart(ui.ColorCyan, 8)
+	d.pendingCompactions = newLineChart(ui.ColorYellow, 12)
+
+	d.keyspaceReads = newBarChart(ui.ColorCyan, 8, 8, "Keyspace Reads/s")
+	d.keyspaceWrites = newBarChart(ui.ColorCyan, 8, 8, "Keyspace Writes/s")
+	d.dcLoad = newBarChart(ui.ColorBlue, 8, 8, "Load by DC")
+
+	//one gauge per running compaction, compactions beyond the number of gauges are not shown
+	d.compactionGauges = make([]*ui.Gauge, 4)
+	for i := range d.compactionGauges {
+		d.compactionGauges[i] = ui.NewGauge()
+		d.compactionGauges[i].Height = 3
+		d.compactionGauges[i].BarColor = ui.ColorYellow
+	}
+
+	d.threadPools = ui.NewList()
+	d.threadPools.Height = 12
+	d.threadPools.Border.Label = "Thread Pools"
+	d.threadPools.ItemFgColor = ui.ColorWhite
+
+	d.tables = ui.NewList()
+	d.tables.ItemFgColor = ui.ColorWhite
+
+	d.cluster = ui.NewList()
+	d.cluster.ItemFgColor = ui.ColorWhite
+	d.cluster.Border.Label = "Cluster (c: dashboard)"
+
+	d.nodes = ui.NewList()
+	d.nodes.ItemFgColor = ui.ColorWhite
+
+	d.tableReadLatency = newBarChart(ui.ColorMagenta, 12, 7, "Read Latency (micros)")
+	d.tableWriteLatency = newBarChart(ui.ColorMagenta, 12, 7, "Write Latency (micros)")
+	d.partitionSize = newBarChart(ui.ColorMagenta, 12, 7, "Partition Size (bytes)")
+	d.cellCount = newBarChart(ui.ColorMagenta, 12, 7, "Cell Count")
+	d.sstablesPerRead = newBarChart(ui.ColorMagenta, 12, 7, "SSTables per Read")
+
+	// build layouts
+	d.views = map[string][]*ui.Row{
+		"dashboard": {
+			ui.NewRow(ui.NewCol(12, 0, d.title)),
+			ui.NewRow(ui.NewCol(12, 0, d.errorStatus)),
+			ui.NewRow(ui.NewCol(12, 0, d.numUpNodes)),
+			ui.NewRow(ui.NewCol(12, 0, d.dcLoad)),
+			ui.NewRow(ui.NewCol(6, 0, d.readLatency), ui.NewCol(6, 0, d.writeLatency)),
+			ui.NewRow(ui.NewCol(6, 0, d.readRate), ui.NewCol(6, 0, d.writeRate)),
+			ui.NewRow(ui.NewCol(6, 0, d.keyspaceReads), ui.NewCol(6, 0, d.keyspaceWrites)),
+			ui.NewRow(ui.NewCol(3, 0, d.heapUsage), ui.NewCol(3, 0, d.gcPause), ui.NewCol(3, 0, d.gcCollections), ui.NewCol(3, 0, d.exceptions)),
+			ui.NewRow(ui.NewCol(6, 0, d.pendingCompactions), ui.NewCol(6, 0, d.compactionGauges[0], d.compactionGauges[1], d.compactionGauges[2], d.compactionGauges[3])),
+			ui.NewRow(ui.NewCol(12, 0, d.threadPools))},
+		"tables": {
+			ui.NewRow(ui.NewCol(12, 0, d.title)),
+			ui.NewRow(ui.NewCol(12, 0, d.tables))},
+		"cluster": {
+			ui.NewRow(ui.NewCol(12, 0, d.title)),
+			ui.NewRow(ui.NewCol(12, 0, d.cluster))},
+		"nodes": {
+			ui.NewRow(ui.NewCol(12, 0, d.title)),
+			ui.NewRow(ui.NewCol(12, 0, d.nodes))},
+		"histograms": {
+			ui.NewRow(ui.NewCol(12, 0, d.title)),
+			ui.NewRow(ui.NewCol(6, 0, d.tableReadLatency), ui.NewCol(6, 0, d.tableWriteLatency)),
+			ui.NewRow(ui.NewCol(6, 0, d.partitionSize), ui.NewCol(6, 0, d.cellCount)),
+			ui.NewRow(ui.NewCol(12, 0, d.sstablesPerRead))},
+	}
+
+	d.body = ui.NewGrid(d.views[d.currentView]...)
+	d.render = func() { ui.Render(d.body) }
+	d.resize(width, height)
+	return d
+}
+
+//run redraws the dashboard on every snapshot, event and tick until the user quits. It is the only place the
+//dashboard is used once constructed.
+func (d *dashboard) run(snapshots <-chan *Snapshot, events <-chan tm.Event, ticks <-chan time.Time) {
+	d.draw()
+	for {
+		select {
+		case d.snapshot = <-snapshots:
+			d.draw()
+		case e := <-events:
+			if d.handleEvent(e) {
+				return
+			}
+		case <-ticks:
+			//only the title depends on the time between snapshots
+			d.updateTitle()
+			d.render()
+		}
+	}
+}
+
+//resize fits the body to the terminal, full screen lists fill whatever the title does not use
+func (d *dashboard) resize(width int, height int) {
+	d.tables.Height = max(height-d.title.Height, 3)
+	d.cluster.Height = max(height-d.title.Height, 3)
+	d.nodes.Height = max(height-d.title.Height, 3)
+	d.body.Width = width
+	d.body.Align()
+}
+
+//handleEvent applies a terminal event returning true if the user asked to quit
+func (d *dashboard) handleEvent(e tm.Event) bool {
+	switch {
+	case e.Type == tm.EventResize:
+		d.resize(e.Width, e.Height)
+		d.render()
+	case e.Type != tm.EventKey:
+	case e.Ch == 'q':
+		return true
+	case e.Ch == 't':
+		d.setView("tables")
+	case e.Ch == 'c':
+		d.setView("cluster")
+	case e.Ch == 'n':
+		d.setView("nodes")
+	case e.Ch == 'l' && d.currentView == "dashboard":
+		d.latencyIdx = (d.latencyIdx + 1) % len(latencyStatistics)
+		d.updateLatencies()
+		d.render()
+	case e.Ch == 'k' && d.currentView == "dashboard":
+		//cycle through every keyspace and back to all keyspaces
+		names := d.snapshot.Keyspaces
+		next := ""
+		for i, name := range names {
+			if name == d.latencyKeyspace && i+1 < len(names) {
+				next = names[i+1]
+			}
+		}
+		if d.latencyKeyspace == "" && len(names) > 0 {
+			next = names[0]
+		}
+		d.latencyKeyspace = next
+		d.updateLatencies()
+		d.render()
+	case e.Key == tm.KeyEnter && d.currentView == "tables":
+		if sorted := sortedTables(d.snapshot.CfStats, tableSorts[d.tableSortIdx]); d.scroll < len(sorted) {
+			d.selectedTable = sorted[d.scroll]
+			d.tableScroll = d.scroll
+			d.collector.SelectTable(d.selectedTable.Keyspace, d.selectedTable.Name)
+			d.collector.Refresh()
+			d.updateHistograms()
+			d.setView("histograms")
+		}
+	case e.Key == tm.KeyEsc && d.currentView == "histograms":
+		//keep the table view scrolled to the table that was opened
+		d.setView("tables")
+		d.scroll = d.tableScroll
+		d.updateLists()
+		d.render()
+	case e.Ch == 's':
+		switch d.currentView {
+		case "tables":
+			d.tableSortIdx = (d.tableSortIdx + 1) % len(tableSorts)
+		case "nodes":
+			d.nodeSortIdx = (d.nodeSortIdx + 1) % len(nodeSorts)
+		}
+		d.updateLists()
+		d.render()
+	case (e.Key == tm.KeyArrowDown || e.Key == tm.KeyArrowUp) && d.currentView != "dashboard":
+		if e.Key == tm.KeyArrowDown {
+			d.scroll++
+		} else {
+			d.scroll = max(d.scroll-1, 0)
+		}
+		d.updateLists()
+		d.render()
+	}
+	return false
+}
+
+//switching to the current view returns to the dashboard
+func (d *dashboard) setView(name string) {
+	if d.currentView == name {
+		name = "dashboard"
+	}
+	if d.currentView == "histograms" {
+		d.collector.SelectTable("", "")
+	}
+	d.currentView = name
+	d.scroll = 0
+	d.updateLists()
+	d.body.Rows = d.views[name]
+	d.body.Align()
+	d.render()
+}
+
+func (d *dashboard) scrollView(view string, rows []string) []string {
+	if view != d.currentView {
+		return rows
+	}
+	if d.scroll > len(rows)-2 {
+		d.scroll = max(len(rows)-2, 0)
+	}
+	return scrollRows(rows, d.scroll)
+}
+
+func (d *dashboard) updateLists() {
+	snapshot := d.snapshot
+	d.tables.Items = d.scrollView("tables", formatTables(snapshot.CfStats, tableSorts[d.tableSortIdx]))
+	if d.currentView == "tables" && len(d.tables.Items) > 1 {
+		//the top row is the one opened by enter
+		d.tables.Items[1] = fmt.Sprintf("[%s](fg-black,bg-cyan)", d.tables.Items[1])
+	}
+	d.tables.Border.Label = fmt.Sprintf("Tables by %s (t: dashboard, s: sort, up/down: scroll, enter: histograms)%s", tableSorts[d.tableSortIdx].name, staleSuffix(snapshot, "cfstats"))
+
+	d.nodes.Items = d.scrollView("nodes", formatNodes(snapshot.Status, nodeSorts[d.nodeSortIdx]))
+	d.nodes.Border.Label = fmt.Sprintf("Nodes by %s (n: dashboard, s: sort, up/down: scroll)%s", nodeSorts[d.nodeSortIdx].name, staleSuffix(snapshot, "status"))
+
+	clusterRows := []string{"Cluster polling is disabled, restart with --cluster to enable"}
+	if d.clusterMode {
+		clusterRows = formatCluster(snapshot.Cluster)
+	}
+	d.cluster.Items = d.scrollView("cluster", clusterRows)
+}
+
+func (d *dashboard) updateHistograms() {
+	//the histograms of a newly selected table arrive with the next snapshot
+	histograms := TableHistograms{}
+	loading := " [loading]"
+	if d.snapshot.SelectedTable.Keyspace == d.selectedTable.Keyspace && d.snapshot.SelectedTable.Name == d.selectedTable.Name {
+		histograms = d.snapshot.TableHistograms
+		loading = staleSuffix(d.snapshot, "tablehistograms")
+	}
+	d.tableReadLatency.DataLabels, d.tableReadLatency.Data = percentileBars(histograms.ReadLatency)
+	d.tableWriteLatency.DataLabels, d.tableWriteLatency.Data = percentileBars(histograms.WriteLatency)
+	d.partitionSize.DataLabels, d.partitionSize.Data = percentileBars(histograms.PartitionSize)
+	d.cellCount.DataLabels, d.cellCount.Data = percentileBars(histograms.CellCount)
+	d.sstablesPerRead.DataLabels, d.sstablesPerRead.Data = percentileBars(histograms.SSTables)
+	d.sstablesPerRead.Border.Label = fmt.Sprintf("SSTables per Read - %s.%s (esc: tables)%s", d.selectedTable.Keyspace, d.selectedTable.Name, loading)
+}
+
+func (d *dashboard) updateLatencies() {
+	statistic := latencyStatistics[d.latencyIdx]
+	command := "proxyhistograms"
+	if statistic == "mean" {
+		command = "cfstats"
+	}
+	read, write := d.snapshot.GetLatencies(statistic)
+
+	//a single keyspace only has a mean latency
+	if d.latencyKeyspace != "" {
+		if keyspaceRead, keyspaceWrite := d.snapshot.GetKeyspaceLatencies(d.latencyKeyspace); keyspaceRead == nil {
+			d.latencyKeyspace = ""
+		} else {
+			read, write = keyspaceRead, keyspaceWrite
+			statistic = d.latencyKeyspace + " mean"
+			command = "cfstats"
+		}
+	}
+	plot(d.readLatency, read)
+	plot(d.writeLatency, write)
+	d.readLatency.Border.Label = fmt.Sprintf("Read Latency %s (%.3f)%s", statistic, read.Last().Value, staleSuffix(d.snapshot, command))
+	d.writeLatency.Border.Label = fmt.Sprintf("Write Latency %s (%.3f)%s", statistic, write.Last().Value, staleSuffix(d.snapshot, command))
+}
+
+//updateTitle shows how far a replay has got
+func (d *dashboard) updateTitle() {
+	d.title.Text = d.snapshot.NodeDescription
+	if d.replayer == nil {
+		return
+	}
+	d.title.Border.Label = fmt.Sprintf("Replay at %s (x%v)", d.replayer.Now().Format("2006-01-02 15:04:05"), d.replaySpeed)
+	if d.replayer.Done() {
+		d.title.Border.Label = "Replay finished at " + d.replayer.Now().Format("2006-01-02 15:04:05")
+	}
+}
+
+//draw updates every widget from the current snapshot and renders the current view
+func (d *dashboard) draw() {
+	snapshot := d.snapshot
+	d.updateTitle()
+
+	d.numUpNodes.Percent = snapshot.PcntNodesUN
+	d.numUpNodes.Border.Label = "Num UN Nodes" + staleSuffix(snapshot, "status")
+
+	//update load
+	status := snapshot.Status
+	labels, loads, unit := datacenterLoads(status)
+	d.dcLoad.DataLabels, d.dcLoad.Data = labels, loads
+	d.dcLoad.Border.Label = fmt.Sprintf("Load by DC (%s, total %s)%s", unit, FormatBytes(status.GetLoadBytes()), staleSuffix(snapshot, "status"))
+
+	//update latencies
+	d.updateLatencies()
+
+	//update throughput
+	plot(d.readRate, snapshot.Series["read_rate"])
+	plot(d.writeRate, snapshot.Series["write_rate"])
+	d.readRate.Border.Label = fmt.Sprintf("Reads/s (%.1f)%s", snapshot.Series["read_rate"].Last().Value, staleSuffix(snapshot, "cfstats"))
+	d.writeRate.Border.Label = fmt.Sprintf("Writes/s (%.1f)%s", snapshot.Series["write_rate"].Last().Value, staleSuffix(snapshot, "cfstats"))
+	d.keyspaceReads.DataLabels, d.keyspaceReads.Data, d.keyspaceWrites.Data = topKeyspaceThroughput(snapshot.KeyspaceThroughput, 8)
+	d.keyspaceWrites.DataLabels = d.keyspaceReads.DataLabels
+
+	//update metrics from info cmd
+	plot(d.exceptions, snapshot.Series["exceptions"])
+	plot(d.heapUsage, snapshot.Series["heap_usage"])
+	d.exceptions.Border.Label = fmt.Sprintf("Exceptions (%v)%s", snapshot.Series["exceptions"].Last().Value, staleSuffix(snapshot, "info"))
+	d.heapUsage.Border.Label = fmt.Sprintf("Heap Used (%.3f)%s", snapshot.Series["heap_usage"].Last().Value, staleSuffix(snapshot, "info"))
+
+	//update gc, each interval covers the time since the previous refresh
+	plot(d.gcPause, snapshot.Series["gc_pause"])
+	plot(d.gcCollections, snapshot.Series["gc_collections"])
+	d.gcPause.Border.Label = fmt.Sprintf("GC Pause ms (%.0f)%s", snapshot.Series["gc_pause"].Last().Value, staleSuffix(snapshot, "gcstats"))
+	d.gcCollections.Border.Label = fmt.Sprintf("GC Collections (%.0f)%s", snapshot.Series["gc_collections"].Last().Value, staleSuffix(snapshot, "gcstats"))
+
+	//update compactions
+	running := snapshot.CompactionStats.Compactions
+	plot(d.pendingCompactions, snapshot.Series["pending_compactions"])
+	d.pendingCompactions.Border.Label = fmt.Sprintf("Pending Compactions (%v)%s", snapshot.Series["pending_compactions"].Last().Value, staleSuffix(snapshot, "compactionstats"))
+	for i, gauge := range d.compactionGauges {
+		if i >= len(running) {
+			gauge.Percent = 0
+			gauge.Border.Label = "Idle"
+			continue
+		}
+		gauge.Percent = int(running[i].Progress)
+		gauge.Border.Label = fmt.Sprintf("%s %s.%s (%d/%d %s)", running[i].Type, running[i].Keyspace, running[i].Table, running[i].Completed, running[i].Total, running[i].Unit)
+	}
+
+	//update thread pools
+	d.threadPools.Items = formatTpStats(snapshot.TpStats)
+	d.threadPools.Border.Label = "Thread Pools" + staleSuffix(snapshot, "tpstats")
+
+	d.updateLists()
+	if d.currentView == "histograms" {
+		d.updateHistograms()
+	}
+
+	//show any failing commands
+	if failures := snapshot.Failures; len(failures) > 0 {
+		d.errorStatus.Text = strings.Join(failures, "\n")
+		d.errorStatus.TextFgColor = ui.ColorRed
+	} else {
+		d.errorStatus.Text = "OK"
+		d.errorStatus.TextFgColor = ui.ColorGreen
+	}
+
+	//do render
+	d.body.Align()
+	d.render()
+}
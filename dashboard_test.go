@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	tm "github.com/nsf/termbox-go"
+)
+
+//TestDashboardConcurrentRefreshAndResize is most useful with -race, the collector, refreshes, key presses and
+//resizes all arrive from different goroutines while the dashboard renders
+func TestDashboardConcurrentRefreshAndResize(t *testing.T) {
+	collector := NewCollector(NewNodetoolWithExecutor(loadFixtures(t, filepath.Join("testdata", "cassandra-4.0"))), 10)
+	d := newDashboard(collector, collector.Data.Snapshot(), 80, 24)
+	renders := 0
+	d.render = func() { renders++ }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collector.Run(ctx, time.Millisecond)
+
+	//snapshots are relayed so the test knows once the dashboard has received one
+	snapshots := make(chan *Snapshot)
+	received := make(chan struct{})
+	go func() {
+		first := true
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case snapshot := <-collector.Snapshots():
+				select {
+				case <-ctx.Done():
+					return
+				case snapshots <- snapshot:
+				}
+				if first {
+					close(received)
+					first = false
+				}
+			}
+		}
+	}()
+
+	events := make(chan tm.Event)
+	ticks := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		d.run(snapshots, events, ticks)
+		close(done)
+	}()
+
+	wg := sync.WaitGroup{}
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			events <- tm.Event{Type: tm.EventResize, Width: 100 + i, Height: 30 + i}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			for _, ch := range []rune{'t', 's', 'n', 'c', 'l', 'k'} {
+				events <- tm.Event{Type: tm.EventKey, Ch: ch}
+			}
+			events <- tm.Event{Type: tm.EventKey, Key: tm.KeyArrowDown}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			collector.Refresh()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			ticks <- time.Now()
+		}
+	}()
+	wg.Wait()
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the dashboard to receive a snapshot")
+	}
+	events <- tm.Event{Type: tm.EventKey, Ch: 'q'}
+	<-done
+
+	if len(d.snapshot.Status.Datacenters) == 0 {
+		t.Error("Expected a collected snapshot to be drawn")
+	}
+	if d.body.Width != 199 || d.nodes.Height != 129-d.title.Height {
+		t.Error("Expected the last resize to apply", d.body.Width, d.nodes.Height)
+	}
+	if renders == 0 {
+		t.Error("Expected the dashboard to render")
+	}
+}
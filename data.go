@@ -0,0 +1,553 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+//Failure describes a nodetool command that is currently failing
+type Failure struct {
+	Err     error
+	Since   time.Time
+	Retries int
+}
+
+//Throughput is a rate of operations per second
+type Throughput struct {
+	Reads  float64
+	Writes float64
+}
+
+//counterSample holds the cumulative cfstats counters used to derive throughput
+type counterSample struct {
+	at         time.Time
+	generation int64
+	keyspaces  map[string]Keyspace
+}
+
+//keyspaceLatency holds the latency timeseries of a single keyspace
+type keyspaceLatency struct {
+	read  *Series
+	write *Series
+}
+
+//Data provides acess to nodetool data in the correct format
+type Data struct {
+	//ExcludeSystemKeyspaces leaves system keyspaces out of the aggregated latency
+	ExcludeSystemKeyspaces bool
+
+	nodetool            DataSource
+	capacity            int
+	series              map[string]*Series
+	history             *Store
+	historySince        time.Time
+	historyRetention    time.Duration
+	lastPrune           time.Time
+	readLatency         *Series
+	writeLatency        *Series
+	readRate            *Series
+	writeRate           *Series
+	numExceptions       *Series
+	heapUsage           *Series
+	pcntNodesUN         int
+	lastStatus          Status
+	lastInfo            Info
+	lastCfStats         CfStats
+	lastTpStats         TpStats
+	lastCompactionStats CompactionStats
+	pendingCompactions  *Series
+	lastProxyHistograms ProxyHistograms
+	lastTableHistograms map[string]TableHistograms
+	lastGcStats         GcStats
+	keyspaceLatency     map[string]*keyspaceLatency
+	gcPause             *Series
+	gcCollections       *Series
+	readP95             *Series
+	readP99             *Series
+	writeP95            *Series
+	writeP99            *Series
+	lastCounters        *counterSample
+	throughput          map[string]Throughput
+	failures            map[string]*Failure
+	unsupported         map[string]bool
+	now                 func() time.Time
+}
+
+//defaultCapacity is the number of samples kept in each timeseries by NewData
+const defaultCapacity = 60
+
+//pruneInterval is how often samples older than the history retention are removed from disk
+const pruneInterval = 10 * time.Minute
+
+//NewData constructs a Data instance reading from the given source
+func NewData(source DataSource) *Data {
+	return NewDataWithCapacity(source, defaultCapacity)
+}
+
+//NewDataWithCapacity constructs a Data instance keeping up to capacity samples in each timeseries. Each timeseries
+//starts with a single zero sample so there is always something to chart.
+func NewDataWithCapacity(source DataSource, capacity int) *Data {
+	return NewDataWithClock(source, capacity, time.Now)
+}
+
+//NewDataWithClock constructs a Data instance like NewDataWithCapacity that timestamps samples, including the initial
+//zero samples, with the given clock e.g. the recorded time of a replay
+func NewDataWithClock(source DataSource, capacity int, now func() time.Time) *Data {
+	d := &Data{
+		nodetool:            source,
+		capacity:            capacity,
+		series:              make(map[string]*Series),
+		lastTableHistograms: make(map[string]TableHistograms),
+		keyspaceLatency:     make(map[string]*keyspaceLatency),
+		throughput:          make(map[string]Throughput),
+		failures:            make(map[string]*Failure),
+		unsupported:         make(map[string]bool),
+		now:                 now,
+	}
+	for name, series := range map[string]**Series{
+		"read_latency":        &d.readLatency,
+		"write_latency":       &d.writeLatency,
+		"read_rate":           &d.readRate,
+		"write_rate":          &d.writeRate,
+		"exceptions":          &d.numExceptions,
+		"heap_usage":          &d.heapUsage,
+		"pending_compactions": &d.pendingCompactions,
+		"gc_pause":            &d.gcPause,
+		"gc_collections":      &d.gcCollections,
+		"read_p95":            &d.readP95,
+		"read_p99":            &d.readP99,
+		"write_p95":           &d.writeP95,
+		"write_p99":           &d.writeP99,
+	} {
+		*series = d.newSeries(name)
+	}
+	return d
+}
+
+//newSeries returns a named timeseries with the configured capacity holding a single zero sample, or its history if
+//history is enabled
+func (d *Data) newSeries(name string) *Series {
+	series := NewSeries(d.capacity)
+	d.series[name] = series
+	if d.history != nil {
+		d.loadHistory(name, series)
+		return series
+	}
+	series.Add(d.now(), 0)
+	return series
+}
+
+//EnableHistory replaces every timeseries with its samples since the given time from the store and writes every
+//new sample to the store. Samples older than retention are removed from the store by PruneHistory, a retention of
+//0 keeps every sample.
+func (d *Data) EnableHistory(store *Store, since time.Time, retention time.Duration) {
+	d.history = store
+	d.historySince = since
+	d.historyRetention = retention
+	for name, series := range d.series {
+		d.loadHistory(name, series)
+	}
+}
+
+//loadHistory fills a series from the history store and persists any samples added to it from now on. Failures
+//are reported like a failing command.
+func (d *Data) loadHistory(name string, series *Series) {
+	samples, err := d.history.Load(name, d.historySince)
+	if err != nil {
+		d.recordResult("history", err)
+	}
+
+	series.sink = nil
+	series.Clear()
+	for _, sample := range samples {
+		series.Add(sample.At, sample.Value)
+	}
+	if series.Len() == 0 {
+		series.Add(d.now(), 0)
+	}
+	series.sink = func(sample Sample) {
+		d.recordResult("history", d.history.Append(name, sample))
+	}
+}
+
+//PruneHistory removes samples older than the history retention from the store if it has not done so within the
+//prune interval. Failures are reported like a failing command.
+func (d *Data) PruneHistory() {
+	if d.history == nil || d.historyRetention <= 0 {
+		return
+	}
+	now := d.now()
+	if now.Sub(d.lastPrune) < pruneInterval {
+		return
+	}
+	d.lastPrune = now
+	d.recordResult("history", d.history.Prune(now.Add(-d.historyRetention)))
+}
+
+//recordResult tracks the outcome of a command and returns true if it succeeded. A command the source does not
+//support is not a failure but is remembered as unsupported.
+func (d *Data) recordResult(command string, err error) bool {
+	if err == nil || err == ErrUnsupported {
+		delete(d.failures, command)
+		if err == nil {
+			delete(d.unsupported, command)
+		} else {
+			d.unsupported[command] = true
+		}
+		return err == nil
+	}
+	delete(d.unsupported, command)
+	if failure, ok := d.failures[command]; ok {
+		failure.Err = err
+		failure.Retries++
+	} else {
+		d.failures[command] = &Failure{Err: err, Since: d.now()}
+	}
+	return false
+}
+
+//IsStale returns true if the last attempt to refresh the data from the given command failed
+func (d *Data) IsStale(command string) bool {
+	_, ok := d.failures[command]
+	return ok
+}
+
+//GetFailures returns a description of each failing command e.g. for display in an error panel
+func (d *Data) GetFailures() []string {
+	commands := make([]string, 0, len(d.failures))
+	for command := range d.failures {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	descriptions := make([]string, 0, len(commands))
+	for _, command := range commands {
+		failure := d.failures[command]
+		descriptions = append(descriptions, fmt.Sprintf("%s: %v (failing for %s, %d retries)", command, failure.Err, d.now().Sub(failure.Since).Truncate(time.Second), failure.Retries))
+	}
+	return descriptions
+}
+
+func (d *Data) GetPcntNodesUN() int {
+	status, err := d.nodetool.GetStatus()
+	if d.recordResult("status", err) {
+		d.lastStatus = status
+		d.pcntNodesUN = int(status.GetPcntUpNormal())
+	}
+	return d.pcntNodesUN
+}
+
+//GetCfMetrics returns a timeseries for read and write latency
+func (d *Data) GetCfMetrics() (read *Series, write *Series) {
+	cfstats, err := d.nodetool.GetCfStats()
+	if !d.recordResult("cfstats", err) {
+		return d.readLatency, d.writeLatency
+	}
+	d.lastCfStats = cfstats
+
+	aggregated := cfstats
+	if d.ExcludeSystemKeyspaces {
+		aggregated = cfstats.WithoutSystemKeyspaces()
+	}
+
+	//keyspaces are weighted by their requests since the previous sample from the same node process, or since the node
+	//started if there is none
+	now := d.now()
+	if prev := d.lastCounters; prev != nil && prev.generation == d.lastInfo.GenerationNo {
+		d.readLatency.Add(now, aggregated.GetRecentReadLatency(prev.keyspaces))
+		d.writeLatency.Add(now, aggregated.GetRecentWriteLatency(prev.keyspaces))
+	} else {
+		d.readLatency.Add(now, aggregated.GetAvgReadLatency())
+		d.writeLatency.Add(now, aggregated.GetAvgWriteLatency())
+	}
+
+	d.updateKeyspaceLatency(cfstats)
+	d.updateThroughput(cfstats)
+
+	return d.readLatency, d.writeLatency
+}
+
+//updateKeyspaceLatency appends the latency of every keyspace to its own timeseries. Idle keyspaces with a NaN latency
+//are recorded as 0 and keyspaces that no longer exist are dropped.
+func (d *Data) updateKeyspaceLatency(cfstats CfStats) {
+	now := d.now()
+	seen := make(map[string]bool)
+	for _, keyspace := range cfstats.Keyspaces {
+		seen[keyspace.Name] = true
+		series, ok := d.keyspaceLatency[keyspace.Name]
+		if !ok {
+			series = &keyspaceLatency{
+				read:  d.newSeries("keyspace_" + keyspace.Name + "_read_latency"),
+				write: d.newSeries("keyspace_" + keyspace.Name + "_write_latency"),
+			}
+			d.keyspaceLatency[keyspace.Name] = series
+		}
+		series.read.Add(now, zeroIfNaN(keyspace.ReadLatency))
+		series.write.Add(now, zeroIfNaN(keyspace.WriteLatency))
+	}
+	for name := range d.keyspaceLatency {
+		if !seen[name] {
+			delete(d.keyspaceLatency, name)
+			delete(d.series, "keyspace_"+name+"_read_latency")
+			delete(d.series, "keyspace_"+name+"_write_latency")
+		}
+	}
+}
+
+//zeroIfNaN replaces NaN with 0 so the value can be charted
+func zeroIfNaN(value float64) float64 {
+	if math.IsNaN(value) {
+		return 0
+	}
+	return value
+}
+
+//GetKeyspaceNames returns the name of every keyspace with a latency timeseries in alphabetical order
+func (d *Data) GetKeyspaceNames() []string {
+	names := make([]string, 0, len(d.keyspaceLatency))
+	for name := range d.keyspaceLatency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//GetKeyspaceLatencies returns the read and write latency timeseries of a single keyspace without running any
+//commands. Both are nil for an unknown keyspace.
+func (d *Data) GetKeyspaceLatencies(keyspace string) (read *Series, write *Series) {
+	series, ok := d.keyspaceLatency[keyspace]
+	if !ok {
+		return nil, nil
+	}
+	return series.read, series.write
+}
+
+//updateThroughput derives per second read and write rates from the change in cfstats counters since the last sample
+func (d *Data) updateThroughput(cfstats CfStats) {
+	sample := &counterSample{at: d.now(), generation: d.lastInfo.GenerationNo, keyspaces: make(map[string]Keyspace)}
+	for _, keyspace := range cfstats.Keyspaces {
+		sample.keyspaces[keyspace.Name] = keyspace
+	}
+
+	prev := d.lastCounters
+	d.lastCounters = sample
+
+	//without a previous sample from the same node process there is nothing to compare against
+	if prev == nil || prev.generation != sample.generation {
+		return
+	}
+	elapsed := sample.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	throughput := make(map[string]Throughput)
+	total := Throughput{}
+	for name, keyspace := range sample.keyspaces {
+		prevKeyspace, ok := prev.keyspaces[name]
+		if !ok {
+			continue
+		}
+		//counters going backwards means the node restarted before the generation was seen to change
+		if keyspace.ReadCount < prevKeyspace.ReadCount || keyspace.WriteCount < prevKeyspace.WriteCount {
+			return
+		}
+		rate := Throughput{
+			Reads:  float64(keyspace.ReadCount-prevKeyspace.ReadCount) / elapsed,
+			Writes: float64(keyspace.WriteCount-prevKeyspace.WriteCount) / elapsed,
+		}
+		throughput[name] = rate
+		total.Reads += rate.Reads
+		total.Writes += rate.Writes
+	}
+	d.throughput = throughput
+
+	d.readRate.Add(sample.at, total.Reads)
+	d.writeRate.Add(sample.at, total.Writes)
+}
+
+//GetThroughputMetrics returns a timeseries of overall reads and writes per second
+func (d *Data) GetThroughputMetrics() (reads *Series, writes *Series) {
+	return d.readRate, d.writeRate
+}
+
+//GetKeyspaceThroughput returns the most recent reads and writes per second for each keyspace
+func (d *Data) GetKeyspaceThroughput() map[string]Throughput {
+	return d.throughput
+}
+
+//GetInfoMetrics returns metrics from nodetool info
+func (d *Data) GetInfoMetrics() (numExceptions *Series, heapUsage *Series) {
+	info, err := d.nodetool.GetInfo()
+	if !d.recordResult("info", err) {
+		return d.numExceptions, d.heapUsage
+	}
+	d.lastInfo = info
+
+	now := d.now()
+	d.numExceptions.Add(now, float64(info.Exceptions))
+	d.heapUsage.Add(now, float64(info.HeapUsage))
+
+	return d.numExceptions, d.heapUsage
+}
+
+//GetGcMetrics returns timeseries of the total GC pause time (ms) and number of collections in each interval
+func (d *Data) GetGcMetrics() (pause *Series, collections *Series) {
+	gcstats, err := d.nodetool.GetGcStats()
+	if !d.recordResult("gcstats", err) {
+		return d.gcPause, d.gcCollections
+	}
+	d.lastGcStats = gcstats
+
+	now := d.now()
+	d.gcPause.Add(now, gcstats.TotalElapsedMs)
+	d.gcCollections.Add(now, float64(gcstats.Collections))
+
+	return d.gcPause, d.gcCollections
+}
+
+//GetLastGcStats returns the gc stats from the most recent successful call to GetGcMetrics
+func (d *Data) GetLastGcStats() GcStats {
+	return d.lastGcStats
+}
+
+//GetLastStatus returns the status from the most recent successful call to GetPcntNodesUN
+func (d *Data) GetLastStatus() Status {
+	return d.lastStatus
+}
+
+//GetLastInfo returns the most recent successfully fetched info
+func (d *Data) GetLastInfo() Info {
+	return d.lastInfo
+}
+
+//GetLastCfStats returns the cfstats from the most recent successful call to GetCfMetrics
+func (d *Data) GetLastCfStats() CfStats {
+	return d.lastCfStats
+}
+
+//GetLastTpStats returns the thread pool stats from the most recent successful call to GetTpStats
+func (d *Data) GetLastTpStats() TpStats {
+	return d.lastTpStats
+}
+
+//GetTpStats returns the most recent thread pool stats
+func (d *Data) GetTpStats() TpStats {
+	tpstats, err := d.nodetool.GetTpStats()
+	if d.recordResult("tpstats", err) {
+		d.lastTpStats = tpstats
+	}
+	return d.lastTpStats
+}
+
+//GetCompactionMetrics returns a timeseries of pending compactions and the compactions currently running
+func (d *Data) GetCompactionMetrics() (pending *Series, running []Compaction) {
+	stats, err := d.nodetool.GetCompactionStats()
+	if !d.recordResult("compactionstats", err) {
+		return d.pendingCompactions, d.lastCompactionStats.Compactions
+	}
+	d.lastCompactionStats = stats
+
+	d.pendingCompactions.Add(d.now(), float64(stats.PendingTasks))
+
+	return d.pendingCompactions, stats.Compactions
+}
+
+//GetLastCompactionStats returns the compaction stats from the most recent successful call to GetCompactionMetrics
+func (d *Data) GetLastCompactionStats() CompactionStats {
+	return d.lastCompactionStats
+}
+
+//GetProxyMetrics updates the read and write latency percentiles from proxyhistograms. Percentiles are converted
+//to milliseconds to match the latencies reported by cfstats.
+func (d *Data) GetProxyMetrics() ProxyHistograms {
+	histograms, err := d.nodetool.GetProxyHistograms()
+	if !d.recordResult("proxyhistograms", err) {
+		return d.lastProxyHistograms
+	}
+	d.lastProxyHistograms = histograms
+
+	now := d.now()
+	d.readP95.Add(now, histograms.Read.P95/1000)
+	d.readP99.Add(now, histograms.Read.P99/1000)
+	d.writeP95.Add(now, histograms.Write.P95/1000)
+	d.writeP99.Add(now, histograms.Write.P99/1000)
+
+	return histograms
+}
+
+//GetLastProxyHistograms returns the histograms from the most recent successful call to GetProxyMetrics
+func (d *Data) GetLastProxyHistograms() ProxyHistograms {
+	return d.lastProxyHistograms
+}
+
+//GetTableHistograms returns the histograms of a single table. The last good result for the table is returned if
+//the command fails.
+func (d *Data) GetTableHistograms(keyspace string, table string) TableHistograms {
+	histograms, err := d.nodetool.GetTableHistograms(keyspace, table)
+	if d.recordResult("tablehistograms", err) {
+		d.lastTableHistograms[keyspace+"."+table] = histograms
+	}
+	return d.lastTableHistograms[keyspace+"."+table]
+}
+
+//GetLatencies returns the read and write latency timeseries (ms) for a statistic (mean, p95 or p99) without
+//running any commands
+func (d *Data) GetLatencies(statistic string) (read *Series, write *Series) {
+	switch statistic {
+	case "p95":
+		return d.readP95, d.writeP95
+	case "p99":
+		return d.readP99, d.writeP99
+	default:
+		return d.readLatency, d.writeLatency
+	}
+}
+
+//describeNode shows identification info about the node as well as some status details
+func describeNode(info Info) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "Unknown"
+	}
+
+	return fmt.Sprintf("%s::%s::%s | %s GOSSIP %s THRIFT %s NATIVE", info.DataCenter, info.Rack, hostname, boolToUnicode(info.GossipActive), boolToUnicode(info.ThriftActive), boolToUnicode(info.NativeTransportActive))
+}
+
+//Snapshot returns a copy of the current state without running any commands
+func (d *Data) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		At:                 d.now(),
+		NodeDescription:    describeNode(d.lastInfo),
+		PcntNodesUN:        d.pcntNodesUN,
+		Status:             d.lastStatus,
+		Info:               d.lastInfo,
+		CfStats:            d.lastCfStats,
+		TpStats:            d.lastTpStats,
+		CompactionStats:    d.lastCompactionStats,
+		ProxyHistograms:    d.lastProxyHistograms,
+		GcStats:            d.lastGcStats,
+		KeyspaceThroughput: make(map[string]Throughput, len(d.throughput)),
+		Keyspaces:          d.GetKeyspaceNames(),
+		Series:             make(map[string]*Series, len(d.series)),
+		Failures:           d.GetFailures(),
+		stale:              make(map[string]bool, len(d.failures)),
+		unsupported:        make(map[string]bool, len(d.unsupported)),
+	}
+	for name, throughput := range d.throughput {
+		snapshot.KeyspaceThroughput[name] = throughput
+	}
+	for name, series := range d.series {
+		snapshot.Series[name] = series.Copy()
+	}
+	for command := range d.failures {
+		snapshot.stale[command] = true
+	}
+	for command := range d.unsupported {
+		snapshot.unsupported[command] = true
+	}
+	return snapshot
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//dumpCommands maps each dumpable nodetool command to a function fetching its typed result
+var dumpCommands = map[string]func(DataSource) (interface{}, error){
+	"status":          func(source DataSource) (interface{}, error) { return source.GetStatus() },
+	"info":            func(source DataSource) (interface{}, error) { return source.GetInfo() },
+	"cfstats":         func(source DataSource) (interface{}, error) { return source.GetCfStats() },
+	"tpstats":         func(source DataSource) (interface{}, error) { return source.GetTpStats() },
+	"compactionstats": func(source DataSource) (interface{}, error) { return source.GetCompactionStats() },
+	"proxyhistograms": func(source DataSource) (interface{}, error) { return source.GetProxyHistograms() },
+	"gcstats":         func(source DataSource) (interface{}, error) { return source.GetGcStats() },
+}
+
+//Dump executes a single nodetool command and writes the parsed result to w in the given format (json or yaml)
+func Dump(source DataSource, command string, format string, w io.Writer) error {
+	fetch, ok := dumpCommands[command]
+	if !ok {
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	result, err := fetch(source)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch format {
+	case "json":
+		out, err = json.MarshalIndent(result, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(result)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+//runDump handles the arguments of the dump sub command e.g. "status --format json"
+func runDump(source DataSource, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := fs.String("format", "json", "Output format: json or yaml")
+
+	//allow the command to come before or after the flags
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if command == "" {
+		command = fs.Arg(0)
+	}
+	if command == "" {
+		return fmt.Errorf("usage: ntdash dump status|info|cfstats|tpstats|compactionstats|proxyhistograms|gcstats [--format json|yaml]")
+	}
+
+	return Dump(source, command, *format, w)
+}
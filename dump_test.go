@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDumpJSON(t *testing.T) {
+	source := NewNodetoolWithExecutor(FixtureExecutor{
+		"info": `ID               : db28e0b4-b502-4c37-9c3a-45579987df89
+    Data Center      : DC1
+    Exceptions       : 108
+    Row Cache        : entries 0, size 0 bytes, capacity 0 bytes, 0 hits, 0 requests, NaN recent hit rate, 7200 save period in seconds`,
+	})
+
+	buf := &bytes.Buffer{}
+	if err := Dump(source, "info", "json", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	info := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if info["DataCenter"] != "DC1" || info["Exceptions"] != 108.0 {
+		t.Error("Dumped info is incorrect", info)
+	}
+	if rowCache, ok := info["RowCache"].(map[string]interface{}); !ok || rowCache["RecentHitRate"] != nil || rowCache["SavePeriod"] != 7200.0 {
+		t.Error("Dumped row cache is incorrect", info["RowCache"])
+	}
+
+	if err := Dump(source, "status", "json", buf); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
+	if err := Dump(source, "ring", "json", buf); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+}
+
+func TestDumpYAML(t *testing.T) {
+	source := NewNodetoolWithExecutor(FixtureExecutor{
+		"info": `ID               : db28e0b4-b502-4c37-9c3a-45579987df89
+    Data Center      : DC1
+    Exceptions       : 108
+    Row Cache        : entries 0, size 0 bytes, capacity 0 bytes, 0 hits, 0 requests, NaN recent hit rate, 7200 save period in seconds`,
+	})
+
+	buf := &bytes.Buffer{}
+	if err := runDump(source, []string{"info", "--format", "yaml"}, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	info := map[string]interface{}{}
+	if err := yaml.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if info["datacenter"] != "DC1" || info["exceptions"] != 108 {
+		t.Error("Dumped info is incorrect", info)
+	}
+	rowCache, ok := info["rowcache"].(map[interface{}]interface{})
+	if !ok || rowCache["saveperiod"] != 7200 {
+		t.Error("Dumped row cache is incorrect", info["rowcache"])
+	}
+	if rate, ok := rowCache["recenthitrate"].(float64); !ok || !math.IsNaN(rate) {
+		t.Error("Expected a NaN hit rate to be dumped as .nan", rowCache["recenthitrate"])
+	}
+}
+
+func TestDumpUnknownFormat(t *testing.T) {
+	source := NewNodetoolWithExecutor(FixtureExecutor{"info": "Exceptions       : 108"})
+
+	buf := &bytes.Buffer{}
+	if err := runDump(source, []string{"info", "--format", "xml"}, buf); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Error("Expected an unknown format to be rejected", err)
+	}
+	if buf.Len() != 0 {
+		t.Error("Expected nothing to be written for an unknown format", buf.String())
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//metricFamily is a single prometheus metric and all of its samples
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []string
+}
+
+//metricSet collects samples grouped by metric name so they can be written in the prometheus text format
+type metricSet struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{families: make([]*metricFamily, 0), index: make(map[string]*metricFamily)}
+}
+
+//add records a sample. Labels are given as name, value pairs.
+func (ms *metricSet) add(name, kind, help string, value float64, labels ...string) {
+	family, ok := ms.index[name]
+	if !ok {
+		family = &metricFamily{name: name, kind: kind, help: help}
+		ms.index[name] = family
+		ms.families = append(ms.families, family)
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabelValue(labels[i+1])))
+	}
+
+	sample := name
+	if len(pairs) > 0 {
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	family.samples = append(family.samples, sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+//WriteTo writes all metrics in the prometheus text exposition format
+func (ms *metricSet) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, family := range ms.families {
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n", family.name, family.help, family.name, family.kind, strings.Join(family.samples, "\n"))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func boolToFloat(val bool) float64 {
+	if val {
+		return 1
+	}
+	return 0
+}
+
+//Exporter collects nodetool data on an interval and serves it as prometheus metrics
+type Exporter struct {
+	collector *Collector
+	mu        sync.Mutex
+	//snapshot is nil until the first collection finishes
+	snapshot *Snapshot
+}
+
+//NewExporter constructs an exporter reading from the given source. Commands running longer than the timeout are
+//reported as failing.
+func NewExporter(source DataSource, timeout time.Duration) *Exporter {
+	collector := NewCollector(source, 1)
+	collector.Timeout = timeout
+	return &Exporter{collector: collector}
+}
+
+//Refresh fetches fresh data from all nodetool commands. Commands run without holding the lock so scrapes are served
+//the previous data until they finish. Refresh must not be called concurrently.
+func (e *Exporter) Refresh() {
+	snapshot := e.collector.Collect(context.Background())
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.snapshot = snapshot
+}
+
+//Run refreshes the data forever at the given interval
+func (e *Exporter) Run(interval time.Duration) {
+	for {
+		e.Refresh()
+		time.Sleep(interval)
+	}
+}
+
+//ServeHTTP serves the metrics, or 503 until the first collection has finished so a scrape never sees zero values
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ms := e.metrics()
+	if ms == nil {
+		http.Error(w, "no data has been collected yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	ms.WriteTo(w)
+}
+
+//metrics returns the most recent data as a set of prometheus metrics, nil if nothing has been collected yet.
+//Commands the source does not support are left out.
+func (e *Exporter) metrics() *metricSet {
+	e.mu.Lock()
+	snapshot := e.snapshot
+	e.mu.Unlock()
+	if snapshot == nil {
+		return nil
+	}
+
+	ms := newMetricSet()
+
+	commands := []string{"status", "info", "cfstats", "tpstats", "compactionstats", "proxyhistograms", "gcstats"}
+	for _, command := range commands {
+		if snapshot.IsUnsupported(command) {
+			continue
+		}
+		ms.add("ntdash_command_up", "gauge", "Whether the last run of the nodetool command succeeded.", boolToFloat(!snapshot.IsStale(command)), "command", command)
+	}
+
+	status := snapshot.Status
+	info := snapshot.Info
+
+	//find the address of the local node in the ring so local metrics can be labelled with it
+	address := ""
+	for _, dc := range status.Datacenters {
+		for _, node := range dc.Nodes {
+			if node.HostID == info.ID {
+				address = node.Address
+			}
+		}
+	}
+	local := []string{"datacenter", info.DataCenter, "rack", info.Rack, "address", address}
+	withLocal := func(labels ...string) []string {
+		return append(append([]string{}, local...), labels...)
+	}
+
+	//status
+	for _, dc := range status.Datacenters {
+		for _, node := range dc.Nodes {
+			labels := []string{"datacenter", dc.Name, "rack", node.Rack, "address", node.Address, "host_id", node.HostID, "state", node.State}
+			//a node in an unknown state has no sample rather than being reported as down
+			if node.IsStateKnown() {
+				ms.add("cassandra_node_up", "gauge", "Whether the node is reported as up by nodetool status.", boolToFloat(strings.HasPrefix(node.State, "U")), labels...)
+			}
+			ms.add("cassandra_node_load_bytes", "gauge", "Load of the node reported by nodetool status.", float64(node.LoadBytes), labels...)
+			if owns, err := strconv.ParseFloat(strings.TrimSuffix(node.Owns, "%"), 64); err == nil {
+				ms.add("cassandra_node_owns_ratio", "gauge", "Effective ownership of the ring reported by nodetool status.", owns/100, labels...)
+			}
+		}
+	}
+
+	//info
+	ms.add("cassandra_gossip_active", "gauge", "Whether gossip is active.", boolToFloat(info.GossipActive), local...)
+	ms.add("cassandra_thrift_active", "gauge", "Whether thrift is active.", boolToFloat(info.ThriftActive), local...)
+	ms.add("cassandra_native_transport_active", "gauge", "Whether the native transport is active.", boolToFloat(info.NativeTransportActive), local...)
+	ms.add("cassandra_generation", "gauge", "Generation number of the node process.", float64(info.GenerationNo), local...)
+	ms.add("cassandra_uptime_seconds", "gauge", "Uptime of the node process.", float64(info.Uptime), local...)
+	ms.add("cassandra_load_bytes", "gauge", "Load of the node reported by nodetool info.", float64(info.LoadBytes), local...)
+	ms.add("cassandra_heap_usage_percent", "gauge", "Percentage of the heap in use.", info.HeapUsage, local...)
+	ms.add("cassandra_exceptions_total", "counter", "Number of exceptions seen by the node.", float64(info.Exceptions), local...)
+	caches := map[string]Cache{"key": info.KeyCache, "row": info.RowCache, "counter": info.CounterCache}
+	for _, name := range []string{"key", "row", "counter"} {
+		cache := caches[name]
+		ms.add("cassandra_cache_entries", "gauge", "Number of entries in the cache.", float64(cache.Entries), withLocal("cache", name)...)
+		ms.add("cassandra_cache_hits_total", "counter", "Number of cache hits.", float64(cache.Hits), withLocal("cache", name)...)
+		ms.add("cassandra_cache_requests_total", "counter", "Number of cache requests.", float64(cache.Requests), withLocal("cache", name)...)
+		ms.add("cassandra_cache_recent_hit_rate", "gauge", "Recent cache hit rate.", cache.RecentHitRate, withLocal("cache", name)...)
+	}
+
+	//cfstats
+	cfstats := snapshot.CfStats
+	for _, keyspace := range cfstats.Keyspaces {
+		labels := withLocal("keyspace", keyspace.Name)
+		ms.add("cassandra_keyspace_read_count_total", "counter", "Number of local reads for the keyspace.", float64(keyspace.ReadCount), labels...)
+		ms.add("cassandra_keyspace_read_latency_ms", "gauge", "Mean local read latency for the keyspace.", keyspace.ReadLatency, labels...)
+		ms.add("cassandra_keyspace_write_count_total", "counter", "Number of local writes for the keyspace.", float64(keyspace.WriteCount), labels...)
+		ms.add("cassandra_keyspace_write_latency_ms", "gauge", "Mean local write latency for the keyspace.", keyspace.WriteLatency, labels...)
+		ms.add("cassandra_keyspace_pending_flushes", "gauge", "Number of pending flushes for the keyspace.", float64(keyspace.PendingFlushes), labels...)
+	}
+	for _, table := range cfstats.GetTables() {
+		labels := withLocal("keyspace", table.Keyspace, "table", table.Name)
+		ms.add("cassandra_table_sstables", "gauge", "Number of SSTables for the table.", float64(table.SSTableCount), labels...)
+		ms.add("cassandra_table_space_used_live_bytes", "gauge", "Disk space used by live SSTables.", float64(table.SpaceUsedLive), labels...)
+		ms.add("cassandra_table_space_used_total_bytes", "gauge", "Disk space used by all SSTables.", float64(table.SpaceUsedTotal), labels...)
+		ms.add("cassandra_table_read_count_total", "counter", "Number of local reads for the table.", float64(table.LocalReadCount), labels...)
+		ms.add("cassandra_table_read_latency_ms", "gauge", "Mean local read latency for the table.", table.LocalReadLatency, labels...)
+		ms.add("cassandra_table_write_count_total", "counter", "Number of local writes for the table.", float64(table.LocalWriteCount), labels...)
+		ms.add("cassandra_table_write_latency_ms", "gauge", "Mean local write latency for the table.", table.LocalWriteLatency, labels...)
+		ms.add("cassandra_table_bloom_filter_false_ratio", "gauge", "Bloom filter false positive ratio.", table.BloomFilterFalseRatio, labels...)
+		ms.add("cassandra_table_partition_max_bytes", "gauge", "Size of the largest compacted partition.", float64(table.PartitionMaxBytes), labels...)
+		ms.add("cassandra_table_partition_mean_bytes", "gauge", "Mean size of compacted partitions.", float64(table.PartitionMeanBytes), labels...)
+		ms.add("cassandra_table_tombstones_per_slice_avg", "gauge", "Average tombstones per slice over the last five minutes.", table.AvgTombstonesPerSlice, labels...)
+		ms.add("cassandra_table_tombstones_per_slice_max", "gauge", "Maximum tombstones per slice over the last five minutes.", table.MaxTombstonesPerSlice, labels...)
+	}
+
+	//tpstats
+	tpstats := snapshot.TpStats
+	for _, pool := range tpstats.ThreadPools {
+		labels := withLocal("pool", pool.Name)
+		ms.add("cassandra_thread_pool_active", "gauge", "Number of active tasks.", float64(pool.Active), labels...)
+		ms.add("cassandra_thread_pool_pending", "gauge", "Number of pending tasks.", float64(pool.Pending), labels...)
+		ms.add("cassandra_thread_pool_completed_total", "counter", "Number of completed tasks.", float64(pool.Completed), labels...)
+		ms.add("cassandra_thread_pool_blocked", "gauge", "Number of currently blocked tasks.", float64(pool.Blocked), labels...)
+		ms.add("cassandra_thread_pool_all_time_blocked_total", "counter", "Number of tasks blocked since the node started.", float64(pool.AllTimeBlocked), labels...)
+	}
+	for _, msg := range tpstats.DroppedMessages {
+		ms.add("cassandra_dropped_messages_total", "counter", "Number of dropped messages.", float64(msg.Dropped), withLocal("message_type", msg.Type)...)
+	}
+
+	//compactionstats
+	compactions := snapshot.CompactionStats
+	ms.add("cassandra_compaction_pending_tasks", "gauge", "Number of pending compaction tasks.", float64(compactions.PendingTasks), local...)
+	for _, compaction := range compactions.Compactions {
+		labels := withLocal("keyspace", compaction.Keyspace, "table", compaction.Table, "compaction_type", compaction.Type, "id", compaction.ID)
+		ms.add("cassandra_compaction_progress_percent", "gauge", "Progress of a running compaction.", compaction.Progress, labels...)
+	}
+
+	//gcstats, each value covers the interval since the previous refresh
+	if !snapshot.IsUnsupported("gcstats") {
+		gcstats := snapshot.GcStats
+		ms.add("cassandra_gc_interval_milliseconds", "gauge", "Length of the interval the GC stats cover.", gcstats.IntervalMs, local...)
+		ms.add("cassandra_gc_max_elapsed_milliseconds", "gauge", "Longest GC pause in the interval.", gcstats.MaxElapsedMs, local...)
+		ms.add("cassandra_gc_elapsed_milliseconds", "gauge", "Total GC pause time in the interval.", gcstats.TotalElapsedMs, local...)
+		ms.add("cassandra_gc_reclaimed_bytes", "gauge", "Memory reclaimed by GC in the interval.", float64(gcstats.ReclaimedBytes), local...)
+		ms.add("cassandra_gc_collections", "gauge", "Number of collections in the interval.", float64(gcstats.Collections), local...)
+		ms.add("cassandra_direct_memory_bytes", "gauge", "Direct memory in use, -1 if unknown.", float64(gcstats.DirectMemoryBytes), local...)
+	}
+
+	//proxyhistograms
+	if !snapshot.IsUnsupported("proxyhistograms") {
+		histograms := snapshot.ProxyHistograms
+		operations := []struct {
+			name        string
+			percentiles Percentiles
+		}{
+			{"read", histograms.Read},
+			{"write", histograms.Write},
+			{"range", histograms.Range},
+			{"cas_read", histograms.CASRead},
+			{"cas_write", histograms.CASWrite},
+			{"view_write", histograms.ViewWrite},
+		}
+		for _, op := range operations {
+			quantiles := map[string]float64{
+				"0.5": op.percentiles.P50, "0.75": op.percentiles.P75, "0.95": op.percentiles.P95,
+				"0.98": op.percentiles.P98, "0.99": op.percentiles.P99, "0": op.percentiles.Min, "1": op.percentiles.Max,
+			}
+			for _, quantile := range []string{"0", "0.5", "0.75", "0.95", "0.98", "0.99", "1"} {
+				ms.add("cassandra_proxy_latency_microseconds", "gauge", "Coordinator request latency percentiles.", quantiles[quantile], withLocal("operation", op.name, "quantile", quantile)...)
+			}
+		}
+	}
+
+	return ms
+}
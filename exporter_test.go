@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExporterMetrics(t *testing.T) {
+	exporter := NewExporter(NewNodetoolWithExecutor(FixtureExecutor{
+		"status": `Datacenter: DC1
+==================
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address       Load       Tokens  Owns    Host ID                               Rack
+UN  10.0.0.6   35.32 GB   256     50%     db28e0b4-b502-4c37-9c3a-45579987df89  5AB
+DN  10.0.0.7   157.74 GB  256     50%     4da97bcf-9831-438b-863c-8a15a19a904e  5AE`,
+		"info": `ID               : db28e0b4-b502-4c37-9c3a-45579987df89
+    Heap Memory (MB) : 3958.00 / 7916.00
+    Data Center      : DC1
+    Rack             : 5AB
+    Load             : 1.5 KB
+    Exceptions       : 108`,
+		"cfstats": `Keyspace: ks1
+    Read Count: 100
+    Read Latency: 0.5 ms.
+    Write Count: 200
+    Write Latency: 0.1 ms.
+    Pending Flushes: 0
+        Table: users
+        SSTable count: 12`,
+	}), time.Second)
+	exporter.Refresh()
+
+	buf := &bytes.Buffer{}
+	if _, err := exporter.metrics().WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		`ntdash_command_up{command="status"} 1`,
+		`ntdash_command_up{command="tpstats"} 0`,
+		"# TYPE cassandra_node_up gauge",
+		`cassandra_node_up{datacenter="DC1",rack="5AE",address="10.0.0.7",host_id="4da97bcf-9831-438b-863c-8a15a19a904e",state="DN"} 0`,
+		`cassandra_node_owns_ratio{datacenter="DC1",rack="5AB",address="10.0.0.6",host_id="db28e0b4-b502-4c37-9c3a-45579987df89",state="UN"} 0.5`,
+		`cassandra_node_load_bytes{datacenter="DC1",rack="5AB",address="10.0.0.6",host_id="db28e0b4-b502-4c37-9c3a-45579987df89",state="UN"} 3.7924561223e+10`,
+		`cassandra_load_bytes{datacenter="DC1",rack="5AB",address="10.0.0.6"} 1536`,
+		`cassandra_heap_usage_percent{datacenter="DC1",rack="5AB",address="10.0.0.6"} 50`,
+		"# TYPE cassandra_exceptions_total counter",
+		`cassandra_exceptions_total{datacenter="DC1",rack="5AB",address="10.0.0.6"} 108`,
+		`cassandra_keyspace_write_count_total{datacenter="DC1",rack="5AB",address="10.0.0.6",keyspace="ks1"} 200`,
+		`cassandra_table_sstables{datacenter="DC1",rack="5AB",address="10.0.0.6",keyspace="ks1",table="users"} 12`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected metrics to contain %s\n%s", line, out)
+		}
+	}
+
+	if strings.Count(out, "# TYPE cassandra_node_up ") != 1 {
+		t.Error("Expected samples to be grouped under a single TYPE line")
+	}
+}
+
+//blockingExecutor blocks every command until released
+type blockingExecutor chan struct{}
+
+func (e blockingExecutor) Execute(args ...string) (string, error) {
+	<-e
+	return "", fmt.Errorf("nodetool %s was released", strings.Join(args, " "))
+}
+
+func TestExporterServesWhileRefreshing(t *testing.T) {
+	release := make(blockingExecutor)
+	exporter := NewExporter(NewNodetoolWithExecutor(release), time.Minute)
+	refreshed := make(chan struct{})
+	go func() {
+		exporter.Refresh()
+		close(refreshed)
+	}()
+
+	//nothing is served until the first collection finishes rather than zero values
+	served := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		served <- w.Code
+	}()
+	select {
+	case code := <-served:
+		if code != http.StatusServiceUnavailable {
+			t.Error("Expected metrics to be unavailable before the first collection", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected metrics to be served while commands are running")
+	}
+
+	close(release)
+	<-refreshed
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `ntdash_command_up{command="status"} 0`) {
+		t.Error("Expected the failed collection to be served", w.Code, w.Body.String())
+	}
+}
+
+func TestExporterCommandTimeout(t *testing.T) {
+	release := make(blockingExecutor)
+	defer close(release)
+	exporter := NewExporter(NewNodetoolWithExecutor(release), 50*time.Millisecond)
+
+	started := time.Now()
+	exporter.Refresh()
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Error("Expected commands to be abandoned at the timeout", elapsed)
+	}
+	if !exporter.snapshot.IsStale("status") {
+		t.Error("Expected a command that timed out to be stale", exporter.snapshot.Failures)
+	}
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	storageServiceMBean = "org.apache.cassandra.db:type=StorageService"
+	snitchMBean         = "org.apache.cassandra.db:type=EndpointSnitchInfo"
+)
+
+//tableMetrics are the per table metrics read to build cfstats
+var tableMetrics = []string{
+	"LiveSSTableCount", "LiveDiskSpaceUsed", "TotalDiskSpaceUsed", "SnapshotsSize", "CompressionRatio",
+	"MemtableColumnsCount", "MemtableLiveDataSize", "ReadLatency", "WriteLatency", "PendingFlushes",
+	"BloomFilterFalsePositives", "BloomFilterFalseRatio", "BloomFilterDiskSpaceUsed",
+	"MinPartitionSize", "MaxPartitionSize", "MeanPartitionSize", "MinRowSize", "MaxRowSize", "MeanRowSize",
+	"LiveScannedHistogram", "TombstoneScannedHistogram",
+}
+
+//proxyScopes maps the ClientRequest metric scopes to the proxyhistograms columns
+var proxyScopes = map[string]func(*ProxyHistograms) *Percentiles{
+	"Read":       func(h *ProxyHistograms) *Percentiles { return &h.Read },
+	"Write":      func(h *ProxyHistograms) *Percentiles { return &h.Write },
+	"RangeSlice": func(h *ProxyHistograms) *Percentiles { return &h.Range },
+	"CASRead":    func(h *ProxyHistograms) *Percentiles { return &h.CASRead },
+	"CASWrite":   func(h *ProxyHistograms) *Percentiles { return &h.CASWrite },
+	"ViewWrite":  func(h *ProxyHistograms) *Percentiles { return &h.ViewWrite },
+}
+
+//Jolokia reads the MBeans used by nodetool through a Jolokia agent's HTTP/JSON bridge. It avoids starting a JVM for
+//every command but the agent must be running in Cassandra e.g. with -javaagent:jolokia-jvm-agent.jar.
+type Jolokia struct {
+	//URL is the agent endpoint e.g. http://localhost:8778/jolokia/
+	URL    string
+	client *http.Client
+}
+
+//NewJolokia constructs a data source reading from the Jolokia agent at url. Requests running longer than the timeout
+//are abandoned.
+func NewJolokia(url string, timeout time.Duration) *Jolokia {
+	return &Jolokia{URL: url, client: &http.Client{Timeout: timeout}}
+}
+
+//jolokiaRequest is a single read or exec in a bulk request
+type jolokiaRequest struct {
+	Type      string        `json:"type"`
+	MBean     string        `json:"mbean"`
+	Attribute interface{}   `json:"attribute,omitempty"`
+	Operation string        `json:"operation,omitempty"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+}
+
+//jolokiaResponse is the result of a single request, Error is set if Status is not 200
+type jolokiaResponse struct {
+	Value  json.RawMessage `json:"value"`
+	Status int             `json:"status"`
+	Error  string          `json:"error"`
+}
+
+func read(mbean string, attributes ...string) jolokiaRequest {
+	request := jolokiaRequest{Type: "read", MBean: mbean}
+	switch len(attributes) {
+	case 0:
+	case 1:
+		request.Attribute = attributes[0]
+	default:
+		request.Attribute = attributes
+	}
+	return request
+}
+
+func execute(mbean string, operation string, arguments ...interface{}) jolokiaRequest {
+	return jolokiaRequest{Type: "exec", MBean: mbean, Operation: operation, Arguments: arguments}
+}
+
+//query sends every request in a single bulk request and returns their responses in the same order
+func (j *Jolokia) query(requests ...jolokiaRequest) ([]jolokiaResponse, error) {
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Post(j.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("jolokia: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jolokia: unexpected status %s", resp.Status)
+	}
+
+	responses := make([]jolokiaResponse, 0, len(requests))
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("jolokia: invalid response: %v", err)
+	}
+	if len(responses) != len(requests) {
+		return nil, fmt.Errorf("jolokia: expected %d responses, got %d", len(requests), len(responses))
+	}
+	return responses, nil
+}
+
+//decode unmarshals the value of a response, failing if the request failed
+func (r jolokiaResponse) decode(value interface{}) error {
+	if r.Status != http.StatusOK {
+		return fmt.Errorf("jolokia: %s", r.Error)
+	}
+	return json.Unmarshal(r.Value, value)
+}
+
+//mbeanAttributes are the attributes of every MBean matched by a pattern keyed by MBean name
+type mbeanAttributes map[string]map[string]interface{}
+
+//decodePattern returns the MBeans matched by a pattern read. A pattern matching nothing is not an error as metrics
+//vary between versions.
+func (r jolokiaResponse) decodePattern() (mbeanAttributes, error) {
+	mbeans := mbeanAttributes{}
+	if r.Status == http.StatusNotFound {
+		return mbeans, nil
+	}
+	return mbeans, r.decode(&mbeans)
+}
+
+//mbeanProperties returns the key properties of an MBean name e.g. keyspace and scope
+func mbeanProperties(name string) map[string]string {
+	properties := make(map[string]string)
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	for _, pair := range strings.Split(name, ",") {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			properties[parts[0]] = strings.Trim(parts[1], `"`)
+		}
+	}
+	return properties
+}
+
+//number converts a JSON value to a float. Jolokia writes NaN and infinite doubles as strings.
+func number(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+//integer converts a JSON value to an integer treating NaN as zero
+func integer(value interface{}) int64 {
+	if f := number(value); !math.IsNaN(f) {
+		return int64(f)
+	}
+	return 0
+}
+
+//hostAddress strips the hostname from an address formatted by InetAddress e.g. "cass-1/10.0.0.1"
+func hostAddress(address string) string {
+	if idx := strings.LastIndex(address, "/"); idx >= 0 {
+		return address[idx+1:]
+	}
+	return address
+}
+
+//GetStatus builds the ring from the StorageService and the snitch
+func (j *Jolokia) GetStatus() (Status, error) {
+	responses, err := j.query(
+		read(storageServiceMBean, "LiveNodes", "UnreachableNodes", "JoiningNodes", "LeavingNodes", "MovingNodes", "LoadMap", "EndpointToHostId", "TokenToEndpointMap"),
+		//ownership cannot be calculated if keyspaces have different replication settings
+		read(storageServiceMBean, "Ownership"),
+	)
+	if err != nil {
+		return Status{}, err
+	}
+
+	ring := struct {
+		LiveNodes          []string
+		UnreachableNodes   []string
+		JoiningNodes       []string
+		LeavingNodes       []string
+		MovingNodes        []string
+		LoadMap            map[string]string
+		EndpointToHostId   map[string]string
+		TokenToEndpointMap map[string]string
+	}{}
+	if err := responses[0].decode(&ring); err != nil {
+		return Status{}, err
+	}
+	ownership := map[string]interface{}{}
+	responses[1].decode(&ownership)
+	owns := make(map[string]float64, len(ownership))
+	for address, value := range ownership {
+		owns[hostAddress(address)] = number(value)
+	}
+
+	tokens := make(map[string]int)
+	for _, endpoint := range ring.TokenToEndpointMap {
+		tokens[endpoint]++
+	}
+
+	states := make(map[string]string)
+	for _, address := range ring.LiveNodes {
+		states[address] = "U"
+	}
+	for _, address := range ring.UnreachableNodes {
+		states[address] = "D"
+	}
+	for _, address := range ring.JoiningNodes {
+		if _, ok := states[address]; !ok {
+			states[address] = "U"
+		}
+	}
+	modes := make(map[string]string)
+	for mode, addresses := range map[string][]string{"J": ring.JoiningNodes, "L": ring.LeavingNodes, "M": ring.MovingNodes} {
+		for _, address := range addresses {
+			modes[address] = mode
+		}
+	}
+
+	addresses := make([]string, 0, len(states))
+	for address := range states {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	//the snitch is asked for the location of every node in a second request
+	locate := make([]jolokiaRequest, 0, len(addresses)*2)
+	for _, address := range addresses {
+		locate = append(locate, execute(snitchMBean, "getDatacenter", address), execute(snitchMBean, "getRack", address))
+	}
+	locations, err := j.query(locate...)
+	if err != nil {
+		return Status{}, err
+	}
+
+	datacenters := make([]Datacenter, 0)
+	for i, address := range addresses {
+		dcName, rack := "", ""
+		if err := locations[i*2].decode(&dcName); err != nil {
+			return Status{}, err
+		}
+		if err := locations[i*2+1].decode(&rack); err != nil {
+			return Status{}, err
+		}
+
+		node := Node{Address: address, Load: "?", Tokens: strconv.Itoa(tokens[address]), Owns: "?", HostID: ring.EndpointToHostId[address], Rack: rack}
+		node.State = states[address] + "N"
+		if mode, ok := modes[address]; ok {
+			node.State = states[address] + mode
+		}
+		if load, ok := ring.LoadMap[address]; ok {
+			node.Load = load
+			node.LoadBytes, _ = ParseBytes(load)
+		}
+		if own, ok := owns[address]; ok {
+			node.Owns = fmt.Sprintf("%.1f%%", own*100)
+		}
+
+		dcIdx := -1
+		for k, dc := range datacenters {
+			if dc.Name == dcName {
+				dcIdx = k
+			}
+		}
+		if dcIdx < 0 {
+			datacenters = append(datacenters, Datacenter{Name: dcName, Nodes: make([]Node, 0)})
+			dcIdx = len(datacenters) - 1
+		}
+		datacenters[dcIdx].Nodes = append(datacenters[dcIdx].Nodes, node)
+	}
+	sort.Slice(datacenters, func(a, b int) bool { return datacenters[a].Name < datacenters[b].Name })
+
+	return Status{Datacenters: datacenters}, nil
+}
+
+//GetInfo reads the StorageService, the JVM and the cache metrics
+func (j *Jolokia) GetInfo() (Info, error) {
+	responses, err := j.query(
+		read(storageServiceMBean, "LocalHostId", "GossipRunning", "NativeTransportRunning", "LoadString", "CurrentGenerationNumber"),
+		read("java.lang:type=Runtime", "Uptime"),
+		read("java.lang:type=Memory", "HeapMemoryUsage"),
+		read(snitchMBean, "Datacenter", "Rack"),
+		read("org.apache.cassandra.metrics:type=Storage,name=Exceptions", "Count"),
+		read("org.apache.cassandra.metrics:type=Cache,scope=*,name=*"),
+		//thrift was removed in 4.0
+		read(storageServiceMBean, "RPCServerRunning"),
+		read("org.apache.cassandra.db:type=Caches", "KeyCacheSavePeriodInSeconds", "RowCacheSavePeriodInSeconds", "CounterCacheSavePeriodInSeconds"),
+	)
+	if err != nil {
+		return Info{}, err
+	}
+
+	storage := struct {
+		LocalHostId             string
+		GossipRunning           bool
+		NativeTransportRunning  bool
+		LoadString              string
+		CurrentGenerationNumber int64
+	}{}
+	uptimeMs := int64(0)
+	heap := struct {
+		Used int64 `json:"used"`
+		Max  int64 `json:"max"`
+	}{}
+	location := struct {
+		Datacenter string
+		Rack       string
+	}{}
+	exceptions := int64(0)
+	for i, value := range []interface{}{&storage, &uptimeMs, &heap, &location, &exceptions} {
+		if err := responses[i].decode(value); err != nil {
+			return Info{}, err
+		}
+	}
+	caches, err := responses[5].decodePattern()
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{
+		ID:                    storage.LocalHostId,
+		GossipActive:          storage.GossipRunning,
+		NativeTransportActive: storage.NativeTransportRunning,
+		Load:                  storage.LoadString,
+		GenerationNo:          storage.CurrentGenerationNumber,
+		Uptime:                uptimeMs / 1000,
+		DataCenter:            location.Datacenter,
+		Rack:                  location.Rack,
+		Exceptions:            exceptions,
+	}
+	info.LoadBytes, _ = ParseBytes(info.Load)
+	if heap.Max > 0 {
+		info.HeapUsage = float64(heap.Used) / float64(heap.Max) * 100
+	}
+	responses[6].decode(&info.ThriftActive)
+
+	savePeriods := map[string]int64{}
+	responses[7].decode(&savePeriods)
+
+	//each cache metric is a separate MBean
+	metrics := make(map[string]map[string]map[string]interface{})
+	for name, attributes := range caches {
+		properties := mbeanProperties(name)
+		if metrics[properties["scope"]] == nil {
+			metrics[properties["scope"]] = make(map[string]map[string]interface{})
+		}
+		metrics[properties["scope"]][properties["name"]] = attributes
+	}
+	cache := func(scope string, savePeriod string) Cache {
+		m := metrics[scope]
+		c := Cache{
+			Entries:       integer(m["Entries"]["Value"]),
+			SizeBytes:     integer(m["Size"]["Value"]),
+			CapacityBytes: integer(m["Capacity"]["Value"]),
+			Hits:          integer(m["Hits"]["Count"]),
+			Requests:      integer(m["Requests"]["Count"]),
+			Misses:        integer(m["Misses"]["Count"]),
+			RecentHitRate: number(m["HitRate"]["Value"]),
+			SavePeriod:    savePeriods[savePeriod],
+		}
+		c.Size, c.Capacity = FormatBytes(c.SizeBytes), FormatBytes(c.CapacityBytes)
+		if latency, ok := m["MissLatency"]["Mean"]; ok {
+			c.MissLatency = number(latency)
+		}
+		return c
+	}
+	info.KeyCache = cache("KeyCache", "KeyCacheSavePeriodInSeconds")
+	info.RowCache = cache("RowCache", "RowCacheSavePeriodInSeconds")
+	info.CounterCache = cache("CounterCache", "CounterCacheSavePeriodInSeconds")
+	info.ChunkCache = cache("ChunkCache", "")
+
+	return info, nil
+}
+
+//GetCfStats reads the metrics of every table. Keyspace counts are the sum of their tables and keyspace latencies are
+//the mean of their tables weighted by request count.
+func (j *Jolokia) GetCfStats() (CfStats, error) {
+	requests := make([]jolokiaRequest, len(tableMetrics))
+	for i, name := range tableMetrics {
+		requests[i] = read("org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=" + name)
+	}
+	responses, err := j.query(requests...)
+	if err != nil {
+		return CfStats{}, err
+	}
+
+	//keyspace -> table -> metric -> attribute
+	metrics := make(map[string]map[string]map[string]map[string]interface{})
+	for i, name := range tableMetrics {
+		mbeans, err := responses[i].decodePattern()
+		if err != nil {
+			return CfStats{}, err
+		}
+		for mbean, attributes := range mbeans {
+			properties := mbeanProperties(mbean)
+			keyspace, table := properties["keyspace"], properties["scope"]
+			//secondary indexes are reported as table.index
+			if strings.Contains(table, ".") {
+				continue
+			}
+			if metrics[keyspace] == nil {
+				metrics[keyspace] = make(map[string]map[string]map[string]interface{})
+			}
+			if metrics[keyspace][table] == nil {
+				metrics[keyspace][table] = make(map[string]map[string]interface{})
+			}
+			metrics[keyspace][table][name] = attributes
+		}
+	}
+
+	keyspaces := make([]Keyspace, 0, len(metrics))
+	for keyspaceName, tables := range metrics {
+		keyspace := Keyspace{Name: keyspaceName, Tables: make([]Table, 0, len(tables))}
+		readTotal, writeTotal := 0.0, 0.0
+		for tableName, m := range tables {
+			//partition sizes were called row sizes before 2.2
+			partition := func(name string) int64 {
+				if value, ok := m[name+"PartitionSize"]; ok {
+					return integer(value["Value"])
+				}
+				return integer(m[name+"RowSize"]["Value"])
+			}
+			table := Table{
+				Name:                      tableName,
+				SSTableCount:              integer(m["LiveSSTableCount"]["Value"]),
+				SpaceUsedLive:             integer(m["LiveDiskSpaceUsed"]["Count"]),
+				SpaceUsedTotal:            integer(m["TotalDiskSpaceUsed"]["Count"]),
+				SpaceUsedBySnapshots:      integer(m["SnapshotsSize"]["Value"]),
+				SSTableCompressionRatio:   number(m["CompressionRatio"]["Value"]),
+				MemtableCellCount:         integer(m["MemtableColumnsCount"]["Value"]),
+				MemtableDataSize:          integer(m["MemtableLiveDataSize"]["Value"]),
+				LocalReadCount:            integer(m["ReadLatency"]["Count"]),
+				LocalWriteCount:           integer(m["WriteLatency"]["Count"]),
+				PendingFlushes:            integer(m["PendingFlushes"]["Count"]),
+				BloomFilterFalsePositives: integer(m["BloomFilterFalsePositives"]["Value"]),
+				BloomFilterFalseRatio:     number(m["BloomFilterFalseRatio"]["Value"]),
+				BloomFilterSpaceUsed:      integer(m["BloomFilterDiskSpaceUsed"]["Value"]),
+				PartitionMinBytes:         partition("Min"),
+				PartitionMaxBytes:         partition("Max"),
+				PartitionMeanBytes:        partition("Mean"),
+				AvgLiveCellsPerSlice:      number(m["LiveScannedHistogram"]["Mean"]),
+				MaxLiveCellsPerSlice:      number(m["LiveScannedHistogram"]["Max"]),
+				AvgTombstonesPerSlice:     number(m["TombstoneScannedHistogram"]["Mean"]),
+				MaxTombstonesPerSlice:     number(m["TombstoneScannedHistogram"]["Max"]),
+			}
+			//latencies are reported in microseconds and are NaN before the first request
+			if table.LocalReadCount > 0 {
+				table.LocalReadLatency = number(m["ReadLatency"]["Mean"]) / 1000
+			}
+			if table.LocalWriteCount > 0 {
+				table.LocalWriteLatency = number(m["WriteLatency"]["Mean"]) / 1000
+			}
+
+			keyspace.ReadCount += table.LocalReadCount
+			keyspace.WriteCount += table.LocalWriteCount
+			keyspace.PendingFlushes += table.PendingFlushes
+			readTotal += table.LocalReadLatency * float64(table.LocalReadCount)
+			writeTotal += table.LocalWriteLatency * float64(table.LocalWriteCount)
+			keyspace.Tables = append(keyspace.Tables, table)
+		}
+		if keyspace.ReadCount > 0 {
+			keyspace.ReadLatency = readTotal / float64(keyspace.ReadCount)
+		}
+		if keyspace.WriteCount > 0 {
+			keyspace.WriteLatency = writeTotal / float64(keyspace.WriteCount)
+		}
+		sort.Slice(keyspace.Tables, func(a, b int) bool { return keyspace.Tables[a].Name < keyspace.Tables[b].Name })
+		keyspaces = append(keyspaces, keyspace)
+	}
+	sort.Slice(keyspaces, func(a, b int) bool { return keyspaces[a].Name < keyspaces[b].Name })
+
+	return CfStats{Keyspaces: keyspaces}, nil
+}
+
+//GetTpStats reads the thread pool and dropped message metrics
+func (j *Jolokia) GetTpStats() (TpStats, error) {
+	responses, err := j.query(
+		read("org.apache.cassandra.metrics:type=ThreadPools,path=*,scope=*,name=*"),
+		read("org.apache.cassandra.metrics:type=DroppedMessage,scope=*,name=Dropped", "Count"),
+	)
+	if err != nil {
+		return TpStats{}, err
+	}
+	pools, err := responses[0].decodePattern()
+	if err != nil {
+		return TpStats{}, err
+	}
+	dropped, err := responses[1].decodePattern()
+	if err != nil {
+		return TpStats{}, err
+	}
+
+	byName := make(map[string]*ThreadPool)
+	for mbean, attributes := range pools {
+		properties := mbeanProperties(mbean)
+		pool, ok := byName[properties["scope"]]
+		if !ok {
+			pool = &ThreadPool{Name: properties["scope"]}
+			byName[pool.Name] = pool
+		}
+		switch properties["name"] {
+		case "ActiveTasks":
+			pool.Active = integer(attributes["Value"])
+		case "PendingTasks":
+			pool.Pending = integer(attributes["Value"])
+		case "CompletedTasks":
+			pool.Completed = integer(attributes["Value"])
+		case "CurrentlyBlockedTasks":
+			pool.Blocked = integer(attributes["Count"])
+		case "TotalBlockedTasks":
+			pool.AllTimeBlocked = integer(attributes["Count"])
+		}
+	}
+
+	tpstats := TpStats{ThreadPools: make([]ThreadPool, 0, len(byName)), DroppedMessages: make([]DroppedMessage, 0, len(dropped))}
+	for _, pool := range byName {
+		tpstats.ThreadPools = append(tpstats.ThreadPools, *pool)
+	}
+	sort.Slice(tpstats.ThreadPools, func(a, b int) bool { return tpstats.ThreadPools[a].Name < tpstats.ThreadPools[b].Name })
+	for mbean, attributes := range dropped {
+		tpstats.DroppedMessages = append(tpstats.DroppedMessages, DroppedMessage{Type: mbeanProperties(mbean)["scope"], Dropped: integer(attributes["Count"])})
+	}
+	sort.Slice(tpstats.DroppedMessages, func(a, b int) bool { return tpstats.DroppedMessages[a].Type < tpstats.DroppedMessages[b].Type })
+
+	return tpstats, nil
+}
+
+//GetCompactionStats reads the pending tasks and the compactions running in the CompactionManager
+func (j *Jolokia) GetCompactionStats() (CompactionStats, error) {
+	responses, err := j.query(
+		read("org.apache.cassandra.metrics:type=Compaction,name=PendingTasks", "Value"),
+		read("org.apache.cassandra.db:type=CompactionManager", "Compactions"),
+	)
+	if err != nil {
+		return CompactionStats{}, err
+	}
+
+	stats := CompactionStats{Compactions: make([]Compaction, 0)}
+	if err := responses[0].decode(&stats.PendingTasks); err != nil {
+		return CompactionStats{}, err
+	}
+	running := make([]map[string]string, 0)
+	if err := responses[1].decode(&running); err != nil {
+		return CompactionStats{}, err
+	}
+	for _, c := range running {
+		compaction := Compaction{ID: c["compactionId"], Type: c["taskType"], Keyspace: c["keyspace"], Table: c["columnfamily"], Unit: c["unit"]}
+		compaction.Completed, _ = strconv.ParseInt(c["completed"], 10, 64)
+		compaction.Total, _ = strconv.ParseInt(c["total"], 10, 64)
+		if compaction.Total > 0 {
+			compaction.Progress = float64(compaction.Completed) / float64(compaction.Total) * 100
+		}
+		stats.Compactions = append(stats.Compactions, compaction)
+	}
+	return stats, nil
+}
+
+//percentiles reads the percentiles of a histogram or timer MBean
+func percentiles(attributes map[string]interface{}) Percentiles {
+	return Percentiles{
+		P50: number(attributes["50thPercentile"]),
+		P75: number(attributes["75thPercentile"]),
+		P95: number(attributes["95thPercentile"]),
+		P98: number(attributes["98thPercentile"]),
+		P99: number(attributes["99thPercentile"]),
+		Min: number(attributes["Min"]),
+		Max: number(attributes["Max"]),
+	}
+}
+
+var percentileAttributes = []string{"50thPercentile", "75thPercentile", "95thPercentile", "98thPercentile", "99thPercentile", "Min", "Max"}
+
+//GetProxyHistograms reads the coordinator latency of each request type in microseconds
+func (j *Jolokia) GetProxyHistograms() (ProxyHistograms, error) {
+	responses, err := j.query(read("org.apache.cassandra.metrics:type=ClientRequest,scope=*,name=Latency", percentileAttributes...))
+	if err != nil {
+		return ProxyHistograms{}, err
+	}
+	mbeans, err := responses[0].decodePattern()
+	if err != nil {
+		return ProxyHistograms{}, err
+	}
+
+	histograms := ProxyHistograms{}
+	for mbean, attributes := range mbeans {
+		if column, ok := proxyScopes[mbeanProperties(mbean)["scope"]]; ok {
+			*column(&histograms) = percentiles(attributes)
+		}
+	}
+	return histograms, nil
+}
+
+//GetTableHistograms reads the latency and sstables per read histograms of a table. Partition size and cell count are
+//only exposed as raw buckets so they are left empty.
+func (j *Jolokia) GetTableHistograms(keyspace string, table string) (TableHistograms, error) {
+	mbean := func(name string) string {
+		return fmt.Sprintf("org.apache.cassandra.metrics:type=ColumnFamily,keyspace=%s,scope=%s,name=%s", keyspace, table, name)
+	}
+	responses, err := j.query(
+		read(mbean("SSTablesPerReadHistogram"), percentileAttributes...),
+		read(mbean("ReadLatency"), percentileAttributes...),
+		read(mbean("WriteLatency"), percentileAttributes...),
+	)
+	if err != nil {
+		return TableHistograms{}, err
+	}
+
+	histograms := TableHistograms{}
+	for i, column := range []*Percentiles{&histograms.SSTables, &histograms.ReadLatency, &histograms.WriteLatency} {
+		attributes := map[string]interface{}{}
+		if err := responses[i].decode(&attributes); err != nil {
+			return TableHistograms{}, err
+		}
+		*column = percentiles(attributes)
+	}
+	return histograms, nil
+}
+
+//GetGcStats reads the collections since the previous call, like nodetool gcstats this resets the GCInspector
+func (j *Jolokia) GetGcStats() (GcStats, error) {
+	responses, err := j.query(execute("org.apache.cassandra.service:type=GCInspector", "getAndResetStats"))
+	if err != nil {
+		return GcStats{}, err
+	}
+	values := make([]interface{}, 0)
+	if err := responses[0].decode(&values); err != nil {
+		return GcStats{}, err
+	}
+	if len(values) < 7 {
+		return GcStats{}, errors.New("jolokia: unexpected gc stats")
+	}
+
+	//the deviation is derived from the sum of squares in the same way as nodetool
+	gcstats := GcStats{
+		IntervalMs:        number(values[0]),
+		MaxElapsedMs:      number(values[1]),
+		TotalElapsedMs:    number(values[2]),
+		ReclaimedBytes:    integer(values[4]),
+		Collections:       integer(values[5]),
+		DirectMemoryBytes: integer(values[6]),
+	}
+	mean := gcstats.TotalElapsedMs / float64(gcstats.Collections)
+	gcstats.StdevElapsedMs = math.Sqrt(number(values[3])/float64(gcstats.Collections) - mean*mean)
+	return gcstats, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//jolokiaStub answers bulk requests with canned values keyed by the MBean followed by the attributes read or the
+//operation and its arguments e.g. "java.lang:type=Runtime Uptime" or "... getRack[10.0.0.1]". Anything else is answered
+//as an unknown MBean.
+type jolokiaStub map[string]interface{}
+
+func (s jolokiaStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requests := make([]jolokiaRequest, 0)
+	if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responses := make([]map[string]interface{}, 0, len(requests))
+	for _, request := range requests {
+		key := request.MBean
+		switch attribute := request.Attribute.(type) {
+		case string:
+			key += " " + attribute
+		case []interface{}:
+			for _, name := range attribute {
+				key += fmt.Sprintf(" %v", name)
+			}
+		}
+		if request.Type == "exec" {
+			key += fmt.Sprintf(" %s%v", request.Operation, request.Arguments)
+		}
+
+		if value, ok := s[key]; ok {
+			responses = append(responses, map[string]interface{}{"status": 200, "value": value})
+		} else {
+			responses = append(responses, map[string]interface{}{"status": 404, "error": "javax.management.InstanceNotFoundException : " + key})
+		}
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+func TestJolokia(t *testing.T) {
+	server := httptest.NewServer(jolokiaStub{
+		storageServiceMBean + " LiveNodes UnreachableNodes JoiningNodes LeavingNodes MovingNodes LoadMap EndpointToHostId TokenToEndpointMap": map[string]interface{}{
+			"LiveNodes":          []string{"10.0.0.1", "10.0.0.2"},
+			"UnreachableNodes":   []string{"10.0.0.3"},
+			"JoiningNodes":       []string{},
+			"LeavingNodes":       []string{"10.0.0.2"},
+			"MovingNodes":        []string{},
+			"LoadMap":            map[string]string{"10.0.0.1": "1.5 GiB", "10.0.0.2": "512 MiB"},
+			"EndpointToHostId":   map[string]string{"10.0.0.1": "host-1", "10.0.0.2": "host-2", "10.0.0.3": "host-3"},
+			"TokenToEndpointMap": map[string]string{"-100": "10.0.0.1", "0": "10.0.0.1", "100": "10.0.0.2", "200": "10.0.0.3"},
+		},
+		storageServiceMBean + " Ownership":       map[string]float64{"/10.0.0.1": 0.5, "cass-2/10.0.0.2": 0.25, "/10.0.0.3": 0.25},
+		snitchMBean + " getDatacenter[10.0.0.1]": "dc1",
+		snitchMBean + " getRack[10.0.0.1]":       "r1",
+		snitchMBean + " getDatacenter[10.0.0.2]": "dc2",
+		snitchMBean + " getRack[10.0.0.2]":       "r1",
+		snitchMBean + " getDatacenter[10.0.0.3]": "dc1",
+		snitchMBean + " getRack[10.0.0.3]":       "r2",
+
+		storageServiceMBean + " LocalHostId GossipRunning NativeTransportRunning LoadString CurrentGenerationNumber": map[string]interface{}{
+			"LocalHostId": "host-1", "GossipRunning": true, "NativeTransportRunning": true, "LoadString": "1.5 GiB", "CurrentGenerationNumber": 1697024311,
+		},
+		"java.lang:type=Runtime Uptime":                                   412398123,
+		"java.lang:type=Memory HeapMemoryUsage":                           map[string]int64{"used": 1 << 30, "max": 4 << 30, "committed": 4 << 30},
+		snitchMBean + " Datacenter Rack":                                  map[string]string{"Datacenter": "dc1", "Rack": "r1"},
+		"org.apache.cassandra.metrics:type=Storage,name=Exceptions Count": 7,
+		"org.apache.cassandra.metrics:type=Cache,scope=*,name=*": map[string]interface{}{
+			"org.apache.cassandra.metrics:name=Entries,scope=KeyCache,type=Cache":  map[string]interface{}{"Value": 98231},
+			"org.apache.cassandra.metrics:name=Size,scope=KeyCache,type=Cache":     map[string]interface{}{"Value": 2048},
+			"org.apache.cassandra.metrics:name=Capacity,scope=KeyCache,type=Cache": map[string]interface{}{"Value": 100 << 20},
+			"org.apache.cassandra.metrics:name=Hits,scope=KeyCache,type=Cache":     map[string]interface{}{"Count": 920, "OneMinuteRate": 1.5},
+			"org.apache.cassandra.metrics:name=Requests,scope=KeyCache,type=Cache": map[string]interface{}{"Count": 1000},
+			"org.apache.cassandra.metrics:name=HitRate,scope=KeyCache,type=Cache":  map[string]interface{}{"Value": 0.92},
+			"org.apache.cassandra.metrics:name=HitRate,scope=RowCache,type=Cache":  map[string]interface{}{"Value": "NaN"},
+		},
+		"org.apache.cassandra.db:type=Caches KeyCacheSavePeriodInSeconds RowCacheSavePeriodInSeconds CounterCacheSavePeriodInSeconds": map[string]int64{
+			"KeyCacheSavePeriodInSeconds": 14400, "RowCacheSavePeriodInSeconds": 0, "CounterCacheSavePeriodInSeconds": 7200,
+		},
+
+		"org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=LiveSSTableCount": map[string]interface{}{
+			"org.apache.cassandra.metrics:keyspace=ks1,name=LiveSSTableCount,scope=users,type=ColumnFamily":          map[string]interface{}{"Value": 4},
+			"org.apache.cassandra.metrics:keyspace=ks1,name=LiveSSTableCount,scope=events,type=ColumnFamily":         map[string]interface{}{"Value": 2},
+			"org.apache.cassandra.metrics:keyspace=ks1,name=LiveSSTableCount,scope=events.by_user,type=ColumnFamily": map[string]interface{}{"Value": 1},
+		},
+		"org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=ReadLatency": map[string]interface{}{
+			"org.apache.cassandra.metrics:keyspace=ks1,name=ReadLatency,scope=users,type=ColumnFamily":  map[string]interface{}{"Count": 300, "Mean": 2000.0},
+			"org.apache.cassandra.metrics:keyspace=ks1,name=ReadLatency,scope=events,type=ColumnFamily": map[string]interface{}{"Count": 100, "Mean": 6000.0},
+		},
+		"org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=WriteLatency": map[string]interface{}{
+			"org.apache.cassandra.metrics:keyspace=ks1,name=WriteLatency,scope=users,type=ColumnFamily":  map[string]interface{}{"Count": 0, "Mean": 0.0},
+			"org.apache.cassandra.metrics:keyspace=ks1,name=WriteLatency,scope=events,type=ColumnFamily": map[string]interface{}{"Count": 0, "Mean": 0.0},
+		},
+		"org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=MaxRowSize": map[string]interface{}{
+			"org.apache.cassandra.metrics:keyspace=ks1,name=MaxRowSize,scope=users,type=ColumnFamily": map[string]interface{}{"Value": 4096},
+		},
+		"org.apache.cassandra.metrics:type=ColumnFamily,keyspace=*,scope=*,name=TombstoneScannedHistogram": map[string]interface{}{
+			"org.apache.cassandra.metrics:keyspace=ks1,name=TombstoneScannedHistogram,scope=users,type=ColumnFamily": map[string]interface{}{"Mean": 1.5, "Max": 12},
+		},
+
+		"org.apache.cassandra.metrics:type=ThreadPools,path=*,scope=*,name=*": map[string]interface{}{
+			"org.apache.cassandra.metrics:name=ActiveTasks,path=request,scope=MutationStage,type=ThreadPools":    map[string]interface{}{"Value": 2},
+			"org.apache.cassandra.metrics:name=PendingTasks,path=request,scope=MutationStage,type=ThreadPools":   map[string]interface{}{"Value": 40},
+			"org.apache.cassandra.metrics:name=CompletedTasks,path=request,scope=MutationStage,type=ThreadPools": map[string]interface{}{"Value": 1000},
+			"org.apache.cassandra.metrics:name=TotalBlockedTasks,path=request,scope=ReadStage,type=ThreadPools":  map[string]interface{}{"Count": 3},
+		},
+		"org.apache.cassandra.metrics:type=DroppedMessage,scope=*,name=Dropped Count": map[string]interface{}{
+			"org.apache.cassandra.metrics:name=Dropped,scope=MUTATION,type=DroppedMessage": map[string]interface{}{"Count": 5},
+		},
+
+		"org.apache.cassandra.service:type=GCInspector getAndResetStats[]": []interface{}{10000.0, 50.0, 80.0, 3400.0, 1024, 2, -1},
+	})
+	defer server.Close()
+
+	source := NewJolokia(server.URL, time.Second)
+
+	status, err := source.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Datacenters) != 2 || status.Datacenters[0].Name != "dc1" || len(status.Datacenters[0].Nodes) != 2 {
+		t.Fatal("Status datacenters are incorrect", status)
+	}
+	if node := status.Datacenters[0].Nodes[0]; node.State != "UN" || node.Address != "10.0.0.1" || node.LoadBytes != 3<<29 || node.Tokens != "2" || node.Owns != "50.0%" || node.HostID != "host-1" || node.Rack != "r1" {
+		t.Error("Status node is incorrect", node)
+	}
+	if node := status.Datacenters[0].Nodes[1]; node.State != "DN" || node.Load != "?" {
+		t.Error("Expected an unreachable node without a load", node)
+	}
+	if node := status.Datacenters[1].Nodes[0]; node.State != "UL" || node.Owns != "25.0%" {
+		t.Error("Expected a leaving node", node)
+	}
+
+	info, err := source.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "host-1" || !info.GossipActive || info.ThriftActive || info.LoadBytes != 3<<29 || info.Uptime != 412398 || info.HeapUsage != 25 || info.DataCenter != "dc1" || info.Exceptions != 7 {
+		t.Error("Info is incorrect", info)
+	}
+	if info.KeyCache.Entries != 98231 || info.KeyCache.Size != "2.00 KB" || info.KeyCache.CapacityBytes != 100<<20 || info.KeyCache.Hits != 920 || info.KeyCache.RecentHitRate != 0.92 || info.KeyCache.SavePeriod != 14400 {
+		t.Error("Key cache is incorrect", info.KeyCache)
+	}
+	if !math.IsNaN(info.RowCache.RecentHitRate) {
+		t.Error("Expected a NaN row cache hit rate", info.RowCache.RecentHitRate)
+	}
+
+	cfstats, err := source.GetCfStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfstats.Keyspaces) != 1 || len(cfstats.Keyspaces[0].Tables) != 2 {
+		t.Fatal("Expected one keyspace with two tables and no indexes", cfstats)
+	}
+	keyspace := cfstats.Keyspaces[0]
+	if keyspace.ReadCount != 400 || keyspace.ReadLatency != 3 || keyspace.WriteLatency != 0 {
+		t.Error("Expected the keyspace latency to be weighted by reads", keyspace.ReadCount, keyspace.ReadLatency, keyspace.WriteLatency)
+	}
+	if table := keyspace.Tables[1]; table.Name != "users" || table.SSTableCount != 4 || table.LocalReadLatency != 2 || table.PartitionMaxBytes != 4096 || table.AvgTombstonesPerSlice != 1.5 {
+		t.Error("Table is incorrect", table)
+	}
+
+	tpstats, err := source.GetTpStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpstats.ThreadPools) != 2 || tpstats.ThreadPools[0].Name != "MutationStage" || tpstats.ThreadPools[0].Pending != 40 || tpstats.ThreadPools[1].AllTimeBlocked != 3 {
+		t.Error("Thread pools are incorrect", tpstats.ThreadPools)
+	}
+	if len(tpstats.DroppedMessages) != 1 || tpstats.DroppedMessages[0].Type != "MUTATION" || tpstats.DroppedMessages[0].Dropped != 5 {
+		t.Error("Dropped messages are incorrect", tpstats.DroppedMessages)
+	}
+
+	gcstats, err := source.GetGcStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gcstats.Collections != 2 || gcstats.StdevElapsedMs != 10 || gcstats.DirectMemoryBytes != -1 {
+		t.Error("GC stats are incorrect", gcstats)
+	}
+
+	//a missing MBean fails the command
+	if _, err := source.GetCompactionStats(); err == nil || !strings.Contains(err.Error(), "InstanceNotFoundException") {
+		t.Error("Expected a missing MBean to be reported", err)
+	}
+}
@@ -1,8 +1,18 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	ui "github.com/gizak/termui"
@@ -23,137 +33,440 @@ func boolToUnicode(val bool) string {
 	return "✘"
 }
 
-//Data provides acess to nodetool data in the correct format
-type Data struct {
-	nodetool      Nodetool
-	readLatency   []float64
-	writeLatency  []float64
-	numExceptions []float64
-	heapUsage     []float64
+func staleSuffix(snapshot *Snapshot, command string) string {
+	if snapshot.IsStale(command) {
+		return " [stale]"
+	}
+	return ""
+}
+
+//formatTpStats renders thread pools as table rows with backlogged pools listed first and highlighted
+func formatTpStats(tpstats TpStats) []string {
+	pools := make([]ThreadPool, len(tpstats.ThreadPools))
+	copy(pools, tpstats.ThreadPools)
+	sort.SliceStable(pools, func(i, j int) bool {
+		return pools[i].IsBacklogged() && !pools[j].IsBacklogged()
+	})
+
+	rows := []string{fmt.Sprintf("%-28s %8s %8s %12s %8s %10s", "Pool", "Active", "Pending", "Completed", "Blocked", "All Blocked")}
+	for _, pool := range pools {
+		row := fmt.Sprintf("%-28s %8d %8d %12d %8d %10d", pool.Name, pool.Active, pool.Pending, pool.Completed, pool.Blocked, pool.AllTimeBlocked)
+		if pool.IsBacklogged() {
+			row = fmt.Sprintf("[%s](fg-red)", row)
+		}
+		rows = append(rows, row)
+	}
+
+	dropped := make([]string, 0)
+	for _, msg := range tpstats.DroppedMessages {
+		if msg.Dropped > 0 {
+			dropped = append(dropped, fmt.Sprintf("%s=%d", msg.Type, msg.Dropped))
+		}
+	}
+	if len(dropped) > 0 {
+		rows = append(rows, fmt.Sprintf("[Dropped: %s](fg-red)", strings.Join(dropped, " ")))
+	}
+	return rows
+}
+
+//tableSort is one of the orderings available in the table view
+type tableSort struct {
+	name string
+	less func(a, b KeyspaceTable) bool
+}
+
+var tableSorts = []tableSort{
+	{name: "read latency", less: func(a, b KeyspaceTable) bool { return a.LocalReadLatency > b.LocalReadLatency }},
+	{name: "write latency", less: func(a, b KeyspaceTable) bool { return a.LocalWriteLatency > b.LocalWriteLatency }},
+	{name: "sstables", less: func(a, b KeyspaceTable) bool { return a.SSTableCount > b.SSTableCount }},
+	{name: "tombstones", less: func(a, b KeyspaceTable) bool { return a.AvgTombstonesPerSlice > b.AvgTombstonesPerSlice }},
 }
 
-func (d *Data) GetPcntNodesUN() int {
-	status := d.nodetool.GetStatus()
-	return int(status.GetPcntUpNormal())
+//sortedTables returns every table in the cfstats in the given order
+func sortedTables(cfstats CfStats, order tableSort) []KeyspaceTable {
+	tables := cfstats.GetTables()
+	sort.SliceStable(tables, func(i, j int) bool {
+		return order.less(tables[i], tables[j])
+	})
+	return tables
 }
 
-//GetLatencies returns a timeseries for read and write latency
-func (d *Data) GetCfMetrics() (read []float64, write []float64) {
-	cfstats := d.nodetool.GetCfStats()
+//formatTables renders every table in the cfstats as table rows in the given order
+func formatTables(cfstats CfStats, order tableSort) []string {
+	tables := sortedTables(cfstats, order)
+
+	rows := []string{fmt.Sprintf("%-48s %8s %12s %12s %14s %10s %12s", "Table", "SSTables", "Read (ms)", "Write (ms)", "Space Used", "Tombstones", "Max Part.")}
+	for _, table := range tables {
+		rows = append(rows, fmt.Sprintf("%-48s %8d %12.3f %12.3f %14d %10.1f %12d", table.Keyspace+"."+table.Name, table.SSTableCount, table.LocalReadLatency, table.LocalWriteLatency, table.SpaceUsedLive, table.AvgTombstonesPerSlice, table.PartitionMaxBytes))
+	}
+	return rows
+}
 
-	if len(d.readLatency) > 60 {
-		d.readLatency = d.readLatency[1:]
+//percentileBars returns a histogram column as bar chart data. Values are rounded down as bar charts only show integers.
+func percentileBars(percentiles Percentiles) (labels []string, values []int) {
+	labels = []string{"min", "p50", "p75", "p95", "p98", "p99", "max"}
+	values = []int{
+		int(percentiles.Min), int(percentiles.P50), int(percentiles.P75), int(percentiles.P95),
+		int(percentiles.P98), int(percentiles.P99), int(percentiles.Max),
 	}
-	d.readLatency = append(d.readLatency, cfstats.GetAvgReadLatency())
+	return labels, values
+}
+
+//nodeSort is one of the orderings available in the node view, applied within each datacenter
+type nodeSort struct {
+	name string
+	less func(a, b Node) bool
+}
 
-	if len(d.writeLatency) > 60 {
-		d.writeLatency = d.writeLatency[1:]
+func ownsPcnt(node Node) float64 {
+	owns, err := strconv.ParseFloat(strings.TrimSuffix(node.Owns, "%"), 64)
+	if err != nil {
+		return -1
 	}
-	d.writeLatency = append(d.writeLatency, cfstats.GetAvgWriteLatency())
+	return owns
+}
 
-	return d.readLatency, d.writeLatency
+var nodeSorts = []nodeSort{
+	{name: "address", less: func(a, b Node) bool { return a.Address < b.Address }},
+	{name: "state", less: func(a, b Node) bool { return a.State > b.State }},
+	{name: "rack", less: func(a, b Node) bool { return a.Rack < b.Rack }},
+	{name: "load", less: func(a, b Node) bool { return a.LoadBytes > b.LoadBytes }},
+	{name: "ownership", less: func(a, b Node) bool { return ownsPcnt(a) > ownsPcnt(b) }},
 }
 
-//GetInfoMetrics returns metrics from nodetool info
-func (d *Data) GetInfoMetrics() (numExceptions []float64, heapUsage []float64) {
-	info := d.nodetool.GetInfo()
+//plot shows a timeseries on a line chart labelling the x-axis with the wall-clock time of each sample
+func plot(chart *ui.LineChart, series *Series) {
+	chart.Data = series.Values()
+	chart.DataLabels = series.Labels("15:04:05")
+}
+
+//latencyStatistics are the statistics the latency charts can be switched between
+var latencyStatistics = []string{"mean", "p95", "p99"}
+
+//nodeStateColors maps node states to the colour used to show them, anything else e.g. a down node that was joining
+//is shown in white
+var nodeStateColors = map[string]string{
+	"UN": "fg-green",
+	"DN": "fg-red",
+	"UJ": "fg-blue",
+	"UL": "fg-magenta",
+	"UM": "fg-yellow",
+}
+
+//formatNodes renders every node in the status grouped by datacenter in the given order
+func formatNodes(status Status, order nodeSort) []string {
+	rows := []string{fmt.Sprintf("%-40s %-5s %12s %8s %8s %-38s %s", "Address", "State", "Load", "Tokens", "Owns", "Host ID", "Rack")}
+	for _, dc := range status.Datacenters {
+		nodes := make([]Node, len(dc.Nodes))
+		copy(nodes, dc.Nodes)
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return order.less(nodes[i], nodes[j])
+		})
+
+		rows = append(rows, fmt.Sprintf("[Datacenter: %s](fg-cyan)", dc.Name))
+		for _, node := range nodes {
+			color, ok := nodeStateColors[node.State]
+			if !ok {
+				color = "fg-white"
+			}
+			rows = append(rows, fmt.Sprintf("[%-40s %-5s %12s %8s %8s %-38s %s](%s)", node.Address, node.State, node.Load, node.Tokens, node.Owns, node.HostID, node.Rack, color))
+		}
+	}
+	return rows
+}
+
+//datacenterLoads returns the load of each datacenter as bar chart data. Bar charts only show integers so the unit
+//is GB if the largest datacenter holds at least 1 GB and MB otherwise.
+func datacenterLoads(status Status) (labels []string, loads []int, unit string) {
+	largest := int64(0)
+	for _, dc := range status.Datacenters {
+		if load := dc.GetLoadBytes(); load > largest {
+			largest = load
+		}
+	}
+	unit, shift := "GB", uint(30)
+	if largest < 1<<30 {
+		unit, shift = "MB", 20
+	}
+
+	for _, dc := range status.Datacenters {
+		labels = append(labels, dc.Name)
+		loads = append(loads, int(dc.GetLoadBytes()>>shift))
+	}
+	return labels, loads, unit
+}
+
+//scrollRows keeps the header row in place and skips the first offset rows after it
+func scrollRows(rows []string, offset int) []string {
+	if len(rows) < 2 || offset <= 0 {
+		return rows
+	}
+	if offset > len(rows)-1 {
+		offset = len(rows) - 1
+	}
+	return append([]string{rows[0]}, rows[1+offset:]...)
+}
+
+//topKeyspaceThroughput returns the busiest keyspaces as bar chart data
+func topKeyspaceThroughput(throughput map[string]Throughput, limit int) (labels []string, reads []int, writes []int) {
+	names := make([]string, 0, len(throughput))
+	for name := range throughput {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := throughput[names[i]], throughput[names[j]]
+		if a.Reads+a.Writes == b.Reads+b.Writes {
+			return names[i] < names[j]
+		}
+		return a.Reads+a.Writes > b.Reads+b.Writes
+	})
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	for _, name := range names {
+		labels = append(labels, name)
+		reads = append(reads, int(throughput[name].Reads))
+		writes = append(writes, int(throughput[name].Writes))
+	}
+	return labels, reads, writes
+}
 
-	if len(d.numExceptions) > 60 {
-		d.numExceptions = d.numExceptions[1:]
+//formatCluster renders polled node stats grouped by datacenter with a rollup row for each datacenter
+func formatCluster(stats []NodeStats) []string {
+	rows := []string{fmt.Sprintf("%-40s %-4s %12s %8s %10s %10s %10s", "Node", "", "Load", "Heap %", "Exceptions", "Read (ms)", "Write (ms)")}
+	for _, rollup := range RollupByDatacenter(stats) {
+		rows = append(rows, fmt.Sprintf("[%-40s %-4s %12s %8.1f %10d %10.3f %10.3f](fg-cyan)", fmt.Sprintf("%s (%d/%d reachable)", rollup.Name, rollup.Reachable, rollup.Nodes), "", FormatBytes(rollup.LoadBytes), rollup.AvgHeapUsage, rollup.Exceptions, rollup.AvgReadLatency, rollup.AvgWriteLatency))
+		for _, node := range stats {
+			if node.Datacenter != rollup.Name {
+				continue
+			}
+			if node.Err != nil {
+				rows = append(rows, fmt.Sprintf("[  %-38s %-4s %12s %v](fg-red)", node.Node.Address, node.Node.State, node.Node.Load, node.Err))
+				continue
+			}
+			rows = append(rows, fmt.Sprintf("  %-38s %-4s %12s %8.1f %10d %10.3f %10.3f", node.Node.Address, node.Node.State, node.Node.Load, node.Info.HeapUsage, node.Info.Exceptions, node.CfStats.GetAvgReadLatency(), node.CfStats.GetAvgWriteLatency()))
+		}
 	}
-	d.numExceptions = append(d.numExceptions, float64(info.Exceptions))
+	return rows
+}
 
-	if len(d.heapUsage) > 60 {
-		d.heapUsage = d.heapUsage[1:]
+//readPassword returns the password in a file, falling back to an environment variable if no file is given
+func readPassword(file string, env string) (string, error) {
+	if file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(raw), "\r\n"), nil
+	}
+	if password, ok := os.LookupEnv(env); ok {
+		return password, nil
 	}
-	d.heapUsage = append(d.heapUsage, float64(info.HeapUsage))
+	return "", fmt.Errorf("a password is required, set --password-file or %s", env)
+}
+
+var (
+	exitMu    sync.Mutex
+	exitHooks []func()
+)
 
-	return d.numExceptions, d.heapUsage
+//atExit registers a function to run before ntdash exits through exit
+func atExit(hook func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, hook)
 }
 
-//GetNodeDescription shows identification info about the current node as well as some status details
-func (d *Data) GetNodeDescription() string {
-	info := d.nodetool.GetInfo()
-	hostname, err := os.Hostname()
-	if err != nil || hostname == "" {
-		hostname = "Unknown"
+//exit runs every function registered with atExit, most recent first, and exits with the given code. os.Exit skips
+//deferred calls so every exit path goes through exit to clean up e.g. the password file.
+func exit(code int) {
+	exitMu.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
 	}
+	os.Exit(code)
+}
 
-	return fmt.Sprintf("%s::%s::%s | %s GOSSIP %s THRIFT %s NATIVE", info.DataCenter, info.Rack, hostname, boolToUnicode(info.GossipActive), boolToUnicode(info.ThriftActive), boolToUnicode(info.NativeTransportActive))
+//exitOnSignal exits through exit on an interrupt or termination signal
+func exitOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		exit(1)
+	}()
 }
 
 func main() {
-	err := ui.Init()
-	if err != nil {
-		panic(err)
+	serveMetrics := flag.Bool("serve-metrics", false, "Run without a UI and serve prometheus metrics over HTTP")
+	metricsAddr := flag.String("metrics-addr", ":9500", "Address to serve prometheus metrics on when using --serve-metrics")
+	clusterMode := flag.Bool("cluster", false, "Poll every node in the ring with nodetool -h (press c to view)")
+	clusterTimeout := flag.Duration("cluster-timeout", 5*time.Second, "Maximum time to wait for each node when using --cluster")
+	refresh := flag.Duration("refresh", 10*time.Second, "How often to refresh the data")
+	retention := flag.Duration("retention", 10*time.Minute, "How much history to keep and chart for each metric")
+	historyDir := flag.String("history-dir", "", "Directory to persist metric history in so it survives restarts (disabled if empty)")
+	historyRetention := flag.Duration("history-retention", 24*time.Hour, "How long to keep persisted history on disk, older samples are removed periodically (0 keeps everything)")
+	record := flag.String("record", "", "Save every nodetool output to this file so the session can be replayed")
+	replay := flag.String("replay", "", "Replay a file saved with --record instead of running nodetool")
+	replaySpeed := flag.Float64("replay-speed", 1, "Speed to replay at e.g. 10 for ten times faster than recorded")
+	commandTimeout := flag.Duration("command-timeout", 30*time.Second, "Maximum time to wait for each nodetool command")
+	excludeSystem := flag.Bool("exclude-system-keyspaces", false, "Leave system keyspaces out of the aggregated read and write latency")
+	cqlAddress := flag.String("cql-address", "", "Read metrics from the system_views virtual tables of a Cassandra 4.0+ node e.g. localhost:9042 instead of running nodetool")
+	cqlUsername := flag.String("cql-username", "", "Username for --cql-address, the password is read from the NTDASH_CQL_PASSWORD environment variable")
+	nodetoolPath := flag.String("nodetool", "nodetool", "Path to the nodetool binary")
+	host := flag.String("host", "", "Host to run nodetool against, the local node if empty (nodetool -h)")
+	port := flag.Int("port", 0, "JMX port to run nodetool against, nodetool's default if 0 (nodetool -p)")
+	username := flag.String("username", "", "JMX username (nodetool -u), the password is read from --password-file or the NTDASH_JMX_PASSWORD environment variable")
+	passwordFile := flag.String("password-file", "", "File containing only the JMX password")
+	ssl := flag.Bool("ssl", false, "Connect to JMX with SSL (nodetool --ssl)")
+	jolokiaURL := flag.String("jolokia-url", "", "Read metrics from a Jolokia agent e.g. http://localhost:8778/jolokia/ instead of running nodetool")
+	flag.Parse()
+
+	//every flag is validated before anything is created that would need cleaning up
+	switch {
+	case *refresh <= 0 || *retention < *refresh:
+		fmt.Fprintln(os.Stderr, "refresh must be positive and no longer than retention")
+		os.Exit(2)
+	case *replay != "" && (*record != "" || *historyDir != ""):
+		fmt.Fprintln(os.Stderr, "--replay cannot be combined with --record or --history-dir")
+		os.Exit(2)
+	case *jolokiaURL != "" && *cqlAddress != "":
+		fmt.Fprintln(os.Stderr, "--jolokia-url cannot be combined with --cql-address")
+		os.Exit(2)
+	case (*jolokiaURL != "" || *cqlAddress != "") && (*replay != "" || *record != ""):
+		fmt.Fprintln(os.Stderr, "--jolokia-url and --cql-address cannot be combined with --record or --replay as they save nodetool output")
+		os.Exit(2)
+	case *passwordFile != "" && *username == "":
+		fmt.Fprintln(os.Stderr, "--password-file requires --username")
+		os.Exit(2)
+	case *clusterMode && *serveMetrics:
+		fmt.Fprintln(os.Stderr, "--cluster cannot be combined with --serve-metrics as other nodes are only shown in the UI")
+		os.Exit(2)
+	case *clusterMode && (*jolokiaURL != "" || *cqlAddress != ""):
+		fmt.Fprintln(os.Stderr, "--cluster cannot be combined with --jolokia-url or --cql-address as it polls other nodes with nodetool")
+		os.Exit(2)
+	case *clusterMode && (*replay != "" || *record != ""):
+		fmt.Fprintln(os.Stderr, "--cluster cannot be combined with --record or --replay as other nodes are not recorded")
+		os.Exit(2)
+	}
+	capacity := int(*retention / *refresh)
+	exitOnSignal()
+
+	//the password is handed to nodetool in a private file so it never appears in the process listing
+	nodetool := CommandExecutor{Path: *nodetoolPath, Connection: Connection{Host: *host, Port: *port, Username: *username, SSL: *ssl}, Timeout: *commandTimeout}
+	if *username != "" {
+		password, err := readPassword(*passwordFile, "NTDASH_JMX_PASSWORD")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if nodetool.Connection.PasswordFile, err = WritePasswordFile(*username, password); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		passwordFile := nodetool.Connection.PasswordFile
+		atExit(func() { os.Remove(passwordFile) })
 	}
-	defer ui.Close()
 
-	ui.UseTheme("helloworld")
+	//the source is nodetool unless a recording is being replayed, replays refresh faster to keep up with their speed
+	var executor Executor = &nodetool
+	var replayer *ReplayExecutor
+	interval := *refresh
+	switch {
+	case *replay != "":
+		f, err := os.Open(*replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		replayer, err = NewReplayExecutor(f, *replaySpeed)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		executor = replayer
+		interval = time.Duration(float64(*refresh) / *replaySpeed)
+	case *record != "":
+		f, err := os.Create(*record)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		atExit(func() { f.Close() })
+		executor = NewRecordingExecutor(executor, f)
+	}
+	var source DataSource = NewNodetoolWithExecutor(executor)
+	if *jolokiaURL != "" {
+		source = NewJolokia(*jolokiaURL, *commandTimeout)
+	}
+	if *cqlAddress != "" {
+		cql := NewCQL(*cqlAddress, *commandTimeout)
+		cql.Username, cql.Password = *cqlUsername, os.Getenv("NTDASH_CQL_PASSWORD")
+		atExit(func() { cql.Close() })
+		source = cql
+	}
 
-	data := Data{nodetool: NewNodetool(), readLatency: []float64{0}, writeLatency: []float64{0}, numExceptions: []float64{0}, heapUsage: []float64{0}}
-
-	title := ui.NewPar(data.GetNodeDescription())
-	title.Height = 3
-
-	numUpNodes := ui.NewGauge()
-	numUpNodes.Percent = 0
-	numUpNodes.Height = 3
-	numUpNodes.Border.Label = "Num UN Nodes"
-	numUpNodes.BarColor = ui.ColorGreen
-	numUpNodes.BgColor = ui.ColorRed
-
-	exceptions := ui.NewLineChart()
-	exceptions.Data = []float64{0}
-	exceptions.Height = 8
-	exceptions.AxesColor = ui.ColorWhite
-	exceptions.LineColor = ui.ColorRed
-
-	heapUsage := ui.NewLineChart()
-	heapUsage.Data = []float64{0}
-	heapUsage.Height = 8
-	heapUsage.AxesColor = ui.ColorWhite
-	heapUsage.LineColor = ui.ColorGreen
-
-	readLatency := ui.NewLineChart()
-	readLatency.Data = []float64{0}
-	readLatency.Height = 8
-	readLatency.AxesColor = ui.ColorWhite
-	readLatency.LineColor = ui.ColorGreen
-
-	writeLatency := ui.NewLineChart()
-	writeLatency.Data = []float64{0}
-	writeLatency.Height = 8
-	writeLatency.AxesColor = ui.ColorWhite
-	writeLatency.LineColor = ui.ColorGreen
-
-	// build layout
-	ui.Body.AddRows(
-		ui.NewRow(ui.NewCol(12, 0, title)),
-		ui.NewRow(ui.NewCol(12, 0, numUpNodes)),
-		ui.NewRow(ui.NewCol(6, 0, readLatency), ui.NewCol(6, 0, writeLatency)),
-		ui.NewRow(ui.NewCol(6, 0, heapUsage), ui.NewCol(6, 0, exceptions)))
-
-	//render function
-	draw := func() {
-
-		numUpNodes.Percent = data.GetPcntNodesUN()
-
-		//update latencies
-		readLatency.Data, writeLatency.Data = data.GetCfMetrics()
-		readLatency.Border.Label = fmt.Sprintf("Read Latency (%.3f)", readLatency.Data[len(readLatency.Data)-1])
-		writeLatency.Border.Label = fmt.Sprintf("Write Latency (%.3f)", writeLatency.Data[len(writeLatency.Data)-1])
-
-		//update metrics from info cmd
-		exceptions.Data, heapUsage.Data = data.GetInfoMetrics()
-		exceptions.Border.Label = fmt.Sprintf("Exceptions (%v)", exceptions.Data[len(exceptions.Data)-1])
-		heapUsage.Border.Label = fmt.Sprintf("Heap Used (%.3f)", heapUsage.Data[len(heapUsage.Data)-1])
-
-		//do render
-		ui.Body.Align()
-		ui.Render(ui.Body)
+	if flag.Arg(0) == "dump" {
+		if err := runDump(source, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		exit(0)
 	}
 
+	if *serveMetrics {
+		exporter := NewExporter(source, *commandTimeout)
+		go exporter.Run(interval)
+
+		http.Handle("/metrics", exporter)
+		fmt.Fprintln(os.Stderr, http.ListenAndServe(*metricsAddr, nil))
+		exit(1)
+	}
+
+	//commands run on the collector's goroutine and the UI only reads the snapshots it publishes. Replayed samples are
+	//timestamped with the time they were recorded.
+	clock := time.Now
+	if replayer != nil {
+		clock = replayer.Now
+	}
+	collector := NewCollectorWithClock(source, capacity, clock)
+	collector.Timeout = *commandTimeout
+	if replayer != nil {
+		collector.Done = replayer.Done
+	}
+	if *clusterMode {
+		collector.Cluster = NewCluster(nodetool, *clusterTimeout)
+	}
+	data := collector.Data
+	data.ExcludeSystemKeyspaces = *excludeSystem
+	if *historyDir != "" {
+		store, err := NewStore(*historyDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		atExit(func() { store.Close() })
+		data.EnableHistory(store, time.Now().Add(-*retention), *historyRetention)
+	}
+
+	if err := ui.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(1)
+	}
+	atExit(ui.Close)
+
+	ui.UseTheme("helloworld")
+
+	d := newDashboard(collector, data.Snapshot(), ui.TermWidth(), ui.TermHeight())
+	d.clusterMode = *clusterMode
+	d.replayer = replayer
+	d.replaySpeed = *replaySpeed
+
 	//handle events (e.g. resize)
 	evt := make(chan tm.Event)
 	go func() {
@@ -162,28 +475,12 @@ func main() {
 		}
 	}()
 
-	go func() {
-		var lastRunTs int32
-		for {
-			if int32(time.Now().Unix()) >= lastRunTs+10 {
-				draw()
-				lastRunTs = int32(time.Now().Unix())
-			}
-			time.Sleep(time.Millisecond)
-		}
-	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	atExit(cancel)
+	go collector.Run(ctx, interval)
 
-	for {
-		select {
-		case e := <-evt:
-			if e.Type == tm.EventKey && e.Ch == 'q' {
-				return
-			}
-			if e.Type == tm.EventResize {
-				ui.Body.Width = ui.TermWidth()
-				ui.Body.Align()
-				ui.Render(ui.Body)
-			}
-		}
-	}
+	ticker := time.NewTicker(time.Second)
+	atExit(ticker.Stop)
+	d.run(collector.Snapshots(), evt, ticker.C)
+	exit(0)
 }
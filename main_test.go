@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDataWithFixtureSource(t *testing.T) {
+	source := NewNodetoolWithExecutor(FixtureExecutor{
+		"status": `Datacenter: DC1
+==================
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address       Load       Tokens  Owns    Host ID                               Rack
+UN  10.0.0.6   35.32 GB   256     ?       99ca9b90-ba59-4411-be56-aafcabedc9c6  5AB
+DN  10.0.0.7   157.74 GB  256     50%     4da97bcf-9831-438b-863c-8a15a19a904e  5AE`,
+		"cfstats": `Keyspace: system
+    Read Count: 2711500
+    Read Latency: 1.5 ms.
+    Write Count: 627466930
+    Write Latency: 0.5 ms.
+    Pending Flushes: 1`,
+		"info": `ID               : db28e0b4-b502-4c37-9c3a-45579987df89
+    Heap Memory (MB) : 3958.00 / 7916.00
+    Data Center      : DC1
+    Rack             : 5AB
+    Exceptions       : 108`,
+	})
+
+	data := NewData(source)
+
+	if pcnt := data.GetPcntNodesUN(); pcnt != 50 {
+		t.Error("Percent UN nodes is incorrect", pcnt)
+	}
+
+	read, write := data.GetCfMetrics()
+	if read.Last().Value != 1.5 || write.Last().Value != 0.5 {
+		t.Error("Latencies are incorrect", read.Values(), write.Values())
+	}
+
+	exceptions, heap := data.GetInfoMetrics()
+	if exceptions.Last().Value != 108 || heap.Last().Value != 50 {
+		t.Error("Info metrics are incorrect", exceptions.Values(), heap.Values())
+	}
+}
+
+func TestDataKeepsLastSampleOnFailure(t *testing.T) {
+	fixtures := FixtureExecutor{
+		"cfstats": `Keyspace: system
+    Read Count: 2711500
+    Read Latency: 1.5 ms.
+    Write Count: 627466930
+    Write Latency: 0.5 ms.
+    Pending Flushes: 1`,
+	}
+	data := NewData(NewNodetoolWithExecutor(fixtures))
+
+	read, _ := data.GetCfMetrics()
+	if read.Len() != 2 || data.IsStale("cfstats") {
+		t.Error("Expected a fresh sample", read.Values())
+	}
+
+	delete(fixtures, "cfstats")
+	read, _ = data.GetCfMetrics()
+	read, _ = data.GetCfMetrics()
+	if read.Len() != 2 || read.Values()[1] != 1.5 {
+		t.Error("Expected the last good sample to be kept", read.Values())
+	}
+	if !data.IsStale("cfstats") {
+		t.Error("Expected cfstats to be stale")
+	}
+	if failures := data.GetFailures(); len(failures) != 1 || !strings.Contains(failures[0], "1 retries") {
+		t.Error("Failures are incorrect", failures)
+	}
+}
+
+func TestDataLatencyPercentiles(t *testing.T) {
+	data := NewData(NewNodetoolWithExecutor(FixtureExecutor{
+		"proxyhistograms": `proxy histograms
+Percentile       Read Latency      Write Latency      Range Latency   CAS Read Latency  CAS Write Latency View Write Latency
+                     (micros)           (micros)           (micros)           (micros)           (micros)           (micros)
+50%                    315.85             219.34             654.95               0.00            1358.10               0.00
+95%                   1955.67             785.94            3379.39               0.00            4055.27               0.00
+99%                   4866.32            1358.10            8409.01               0.00            7007.51               0.00`,
+	}))
+
+	histograms := data.GetProxyMetrics()
+	if histograms.CASWrite.P99 != 7007.51 || histograms.ViewWrite.P99 != 0 {
+		t.Error("Histograms are incorrect", histograms)
+	}
+
+	read, write := data.GetLatencies("p95")
+	if fmt.Sprintf("%.5f %.5f", read.Last().Value, write.Last().Value) != "1.95567 0.78594" {
+		t.Error("p95 latencies are incorrect", read.Values(), write.Values())
+	}
+	read, write = data.GetLatencies("p99")
+	if fmt.Sprintf("%.5f %.5f", read.Last().Value, write.Last().Value) != "4.86632 1.35810" {
+		t.Error("p99 latencies are incorrect", read.Values(), write.Values())
+	}
+	if read, _ = data.GetLatencies("mean"); read.Len() != 1 {
+		t.Error("Expected mean latencies to be untouched", read.Values())
+	}
+}
+
+func TestDataThroughput(t *testing.T) {
+	cfstats := func(reads, writes int) string {
+		return fmt.Sprintf(`Keyspace: ks1
+    Read Count: %d
+    Read Latency: 1.5 ms.
+    Write Count: %d
+    Write Latency: 0.5 ms.
+    Pending Flushes: 0`, reads, writes)
+	}
+
+	fixtures := FixtureExecutor{"cfstats": cfstats(1000, 5000), "info": "Generation No    : 1"}
+	data := NewData(NewNodetoolWithExecutor(fixtures))
+	now := time.Unix(0, 0)
+	data.now = func() time.Time { return now }
+
+	data.GetInfoMetrics()
+	data.GetCfMetrics()
+	if reads, _ := data.GetThroughputMetrics(); reads.Len() != 1 {
+		t.Error("Expected no rate from the first sample", reads.Values())
+	}
+
+	now = now.Add(10 * time.Second)
+	fixtures["cfstats"] = cfstats(1500, 6000)
+	data.GetCfMetrics()
+	reads, writes := data.GetThroughputMetrics()
+	if reads.Len() != 2 || reads.Values()[1] != 50 || writes.Values()[1] != 100 {
+		t.Error("Rates are incorrect", reads.Values(), writes.Values())
+	}
+	if ks := data.GetKeyspaceThroughput()["ks1"]; ks.Reads != 50 || ks.Writes != 100 {
+		t.Error("Keyspace rates are incorrect", ks)
+	}
+
+	//counters reset after a restart
+	now = now.Add(10 * time.Second)
+	fixtures["cfstats"] = cfstats(10, 20)
+	data.GetCfMetrics()
+	if reads, _ := data.GetThroughputMetrics(); reads.Len() != 2 {
+		t.Error("Expected no rate across a counter reset", reads.Values())
+	}
+
+	//the new generation is seen so the next interval is also skipped
+	now = now.Add(10 * time.Second)
+	fixtures["info"] = "Generation No    : 2"
+	data.GetInfoMetrics()
+	fixtures["cfstats"] = cfstats(110, 220)
+	data.GetCfMetrics()
+	if reads, _ := data.GetThroughputMetrics(); reads.Len() != 2 {
+		t.Error("Expected no rate across a generation change", reads.Values())
+	}
+
+	now = now.Add(10 * time.Second)
+	fixtures["cfstats"] = cfstats(210, 420)
+	data.GetCfMetrics()
+	if reads, writes := data.GetThroughputMetrics(); reads.Len() != 3 || reads.Values()[2] != 10 || writes.Values()[2] != 20 {
+		t.Error("Rates after restart are incorrect", reads.Values(), writes.Values())
+	}
+}
+
+func TestDataRecentLatency(t *testing.T) {
+	cfstats := func(busyReads, idleReads int) string {
+		return fmt.Sprintf(`Keyspace: busy
+    Read Count: %d
+    Read Latency: 1.0 ms.
+Keyspace: idle
+    Read Count: %d
+    Read Latency: 9.0 ms.`, busyReads, idleReads)
+	}
+
+	//idle served most of its reads before the dashboard started
+	fixtures := FixtureExecutor{"cfstats": cfstats(100, 900), "info": "Generation No    : 1"}
+	data := NewData(NewNodetoolWithExecutor(fixtures))
+	data.GetInfoMetrics()
+	read, _ := data.GetCfMetrics()
+	if read.Last().Value != 8.2 {
+		t.Error("Expected the first sample to be weighted by all reads", read.Values())
+	}
+
+	fixtures["cfstats"] = cfstats(200, 900)
+	read, _ = data.GetCfMetrics()
+	if read.Last().Value != 1.0 {
+		t.Error("Expected only the keyspace taking reads now to count", read.Values())
+	}
+}
+
+func TestDatacenterLoads(t *testing.T) {
+	status := Status{Datacenters: []Datacenter{
+		{Name: "DC1", Nodes: []Node{{LoadBytes: 300 << 20}, {LoadBytes: 212 << 20}}},
+		{Name: "DC2", Nodes: []Node{{LoadBytes: 900 << 20}}},
+	}}
+	if labels, loads, unit := datacenterLoads(status); unit != "MB" || !reflect.DeepEqual(labels, []string{"DC1", "DC2"}) || !reflect.DeepEqual(loads, []int{512, 900}) {
+		t.Error("Expected datacenters under 1 GB in MB", labels, loads, unit)
+	}
+
+	status.Datacenters[1].Nodes[0].LoadBytes = 3 << 30
+	if _, loads, unit := datacenterLoads(status); unit != "GB" || !reflect.DeepEqual(loads, []int{0, 3}) {
+		t.Error("Expected loads in GB once a datacenter holds 1 GB", loads, unit)
+	}
+}
+
+func TestFormatNodes(t *testing.T) {
+	status := Status{Datacenters: []Datacenter{
+		{Name: "DC1", Nodes: []Node{{State: "UN", Address: "10.0.0.2", Owns: "20%"}, {State: "DN", Address: "10.0.0.1", Owns: "30%"}}},
+		{Name: "DC2", Nodes: []Node{
+			{State: "UJ", Address: "10.1.0.1", Owns: "?"},
+			{State: "UL", Address: "10.1.0.2", Owns: "?"},
+			{State: "UM", Address: "10.1.0.3", Owns: "?"},
+			{State: "DL", Address: "10.1.0.4", Owns: "?"},
+		}},
+	}}
+
+	rows := formatNodes(status, nodeSorts[4])
+	if len(rows) != 9 {
+		t.Fatal("Expected a header, a row per datacenter and a row per node", rows)
+	}
+	if !strings.Contains(rows[1], "DC1") || !strings.Contains(rows[4], "DC2") {
+		t.Error("Nodes are not grouped by datacenter", rows)
+	}
+	if !strings.HasPrefix(rows[2], "[10.0.0.1") || !strings.HasSuffix(rows[2], "(fg-red)") {
+		t.Error("Expected the down node with the most ownership first in red", rows[2])
+	}
+	for i, color := range map[int]string{3: "fg-green", 5: "fg-blue", 6: "fg-magenta", 7: "fg-yellow", 8: "fg-white"} {
+		if !strings.HasSuffix(rows[i], "("+color+")") {
+			t.Error("Nodes are not coloured by state", rows[i], color)
+		}
+	}
+
+	if scrolled := scrollRows(rows, 2); len(scrolled) != len(rows)-2 || scrolled[0] != rows[0] || scrolled[1] != rows[3] {
+		t.Error("Scrolling should keep the header", scrolled)
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	f, err := ioutil.TempFile("", "ntdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("from file\n")
+	f.Close()
+
+	os.Setenv("NTDASH_TEST_PASSWORD", "from env")
+	defer os.Unsetenv("NTDASH_TEST_PASSWORD")
+
+	if password, err := readPassword(f.Name(), "NTDASH_TEST_PASSWORD"); err != nil || password != "from file" {
+		t.Error("Expected the file to take precedence without its trailing newline", password, err)
+	}
+	if password, err := readPassword("", "NTDASH_TEST_PASSWORD"); err != nil || password != "from env" {
+		t.Error("Expected the environment variable to be used", password, err)
+	}
+	if _, err := readPassword("", "NTDASH_TEST_MISSING"); err == nil {
+		t.Error("Expected an error without a password")
+	}
+}
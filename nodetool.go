@@ -1,11 +1,19 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 //Status is the result of nodetool status
@@ -13,11 +21,16 @@ type Status struct {
 	Datacenters []Datacenter
 }
 
+//GetPcntUpNormal returns the percentage of nodes that are up and normal. Nodes in an unknown state are left out rather
+//than counted as down.
 func (s *Status) GetPcntUpNormal() int64 {
 	numTotal := 0
 	numUN := 0
 	for _, dc := range s.Datacenters {
 		for _, node := range dc.Nodes {
+			if !node.IsStateKnown() {
+				continue
+			}
 			if node.State == "UN" {
 				numUN++
 			}
@@ -25,24 +38,107 @@ func (s *Status) GetPcntUpNormal() int64 {
 		}
 	}
 
+	if numTotal == 0 {
+		return 0
+	}
 	return int64((float64(numUN) / float64(numTotal)) * 100)
 }
 
+//GetLoadBytes returns the total load of all nodes in the cluster
+func (s *Status) GetLoadBytes() int64 {
+	var total int64
+	for _, dc := range s.Datacenters {
+		total += dc.GetLoadBytes()
+	}
+	return total
+}
+
 //Datacenter is a component of nodetool status
 type Datacenter struct {
 	Name  string
 	Nodes []Node
 }
 
+//GetLoadBytes returns the total load of all nodes in the datacenter
+func (dc *Datacenter) GetLoadBytes() int64 {
+	var total int64
+	for _, node := range dc.Nodes {
+		total += node.LoadBytes
+	}
+	return total
+}
+
+//byteUnits are the multipliers of the size units used by nodetool. Cassandra always uses binary multiples even when
+//the unit is written as e.g. KB rather than KiB.
+var byteUnits = map[string]int64{
+	"bytes": 1,
+	"B":     1,
+	"KB":    1 << 10,
+	"KiB":   1 << 10,
+	"MB":    1 << 20,
+	"MiB":   1 << 20,
+	"GB":    1 << 30,
+	"GiB":   1 << 30,
+	"TB":    1 << 40,
+	"TiB":   1 << 40,
+	"PB":    1 << 50,
+	"PiB":   1 << 50,
+}
+
+//sizePattern matches the human readable sizes output by nodetool e.g. "35.32 GB" or "0 bytes"
+const sizePattern = `[0-9\.]+ (?:bytes|[KMGTP]i?B|B)`
+
+//ParseBytes converts a human readable size e.g. "35.32 GB" into a number of bytes
+func ParseBytes(size string) (int64, error) {
+	parts := strings.Fields(size)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	multiplier, ok := byteUnits[parts[1]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", size)
+	}
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", size, err)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+//FormatBytes converts a number of bytes into a human readable size
+func FormatBytes(bytes int64) string {
+	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	if bytes < 1024 {
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+	value := float64(bytes)
+	unit := ""
+	for _, unit = range units {
+		value /= 1024
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.2f %s", value, unit)
+}
+
 //Node is a component of nodetool status
 type Node struct {
-	State   string
-	Address string
-	Load    string
-	Tokens  string
-	Owns    string
-	HostID  string
-	Rack    string
+	State     string
+	Address   string
+	Port      string
+	Load      string
+	LoadBytes int64
+	Tokens    string
+	Owns      string
+	HostID    string
+	Rack      string
+}
+
+//IsStateKnown returns false for a node whose up/down state could not be determined e.g. a peer listed by a data source
+//that cannot see gossip
+func (n *Node) IsStateKnown() bool {
+	return !strings.HasPrefix(n.State, "?")
 }
 
 //CfStats is the result of nodetool cfstats
@@ -50,22 +146,86 @@ type CfStats struct {
 	Keyspaces []Keyspace
 }
 
-//GetAvgReadLatency returns the average read latency across all keyspaces
+//GetAvgReadLatency returns the read latency across all keyspaces weighted by their read count
 func (cfs *CfStats) GetAvgReadLatency() float64 {
-	sum := 0.0
+	return weightedLatency(cfs.Keyspaces, func(keyspace Keyspace) (float64, int64) {
+		return keyspace.ReadLatency, keyspace.ReadCount
+	})
+}
+
+//GetAvgWriteLatency returns the write latency across all keyspaces weighted by their write count
+func (cfs *CfStats) GetAvgWriteLatency() float64 {
+	return weightedLatency(cfs.Keyspaces, func(keyspace Keyspace) (float64, int64) {
+		return keyspace.WriteLatency, keyspace.WriteCount
+	})
+}
+
+//GetRecentReadLatency returns the read latency across all keyspaces weighted by the reads each served since the
+//previous stats, so the keyspaces taking traffic now count for more than those that were busy in the past. Keyspaces
+//missing from the previous stats are weighted by all of their reads.
+func (cfs *CfStats) GetRecentReadLatency(prev map[string]Keyspace) float64 {
+	return weightedLatency(cfs.Keyspaces, func(keyspace Keyspace) (float64, int64) {
+		return keyspace.ReadLatency, keyspace.ReadCount - prev[keyspace.Name].ReadCount
+	})
+}
+
+//GetRecentWriteLatency returns the write latency across all keyspaces weighted by the writes each served since the
+//previous stats
+func (cfs *CfStats) GetRecentWriteLatency(prev map[string]Keyspace) float64 {
+	return weightedLatency(cfs.Keyspaces, func(keyspace Keyspace) (float64, int64) {
+		return keyspace.WriteLatency, keyspace.WriteCount - prev[keyspace.Name].WriteCount
+	})
+}
+
+//weightedLatency averages keyspace latencies weighted by request count. Keyspaces with no requests or a NaN latency
+//(i.e. idle keyspaces) are ignored and 0 is returned when no keyspace has a latency.
+func weightedLatency(keyspaces []Keyspace, latency func(Keyspace) (float64, int64)) float64 {
+	sum, count := 0.0, int64(0)
+	for _, keyspace := range keyspaces {
+		value, requests := latency(keyspace)
+		if math.IsNaN(value) || requests <= 0 {
+			continue
+		}
+		sum += value * float64(requests)
+		count += requests
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+//systemKeyspaces are the keyspaces managed by Cassandra itself
+var systemKeyspaces = map[string]bool{
+	"system":                true,
+	"system_auth":           true,
+	"system_distributed":    true,
+	"system_schema":         true,
+	"system_traces":         true,
+	"system_views":          true,
+	"system_virtual_schema": true,
+}
+
+//WithoutSystemKeyspaces returns a copy of the stats containing only user keyspaces
+func (cfs *CfStats) WithoutSystemKeyspaces() CfStats {
+	filtered := CfStats{Keyspaces: make([]Keyspace, 0, len(cfs.Keyspaces))}
 	for _, keyspace := range cfs.Keyspaces {
-		sum += keyspace.ReadLatency
+		if !systemKeyspaces[keyspace.Name] {
+			filtered.Keyspaces = append(filtered.Keyspaces, keyspace)
+		}
 	}
-	return sum / float64(len(cfs.Keyspaces))
+	return filtered
 }
 
-//GetAvgWriteLatency returns the average write latency across all keyspaces
-func (cfs *CfStats) GetAvgWriteLatency() float64 {
-	sum := 0.0
+//GetTables returns every table across all keyspaces
+func (cfs *CfStats) GetTables() []KeyspaceTable {
+	tables := make([]KeyspaceTable, 0)
 	for _, keyspace := range cfs.Keyspaces {
-		sum += keyspace.WriteLatency
+		for _, table := range keyspace.Tables {
+			tables = append(tables, KeyspaceTable{Keyspace: keyspace.Name, Table: table})
+		}
 	}
-	return sum / float64(len(cfs.Keyspaces))
+	return tables
 }
 
 //Keyspace is the result of cfstats
@@ -76,6 +236,40 @@ type Keyspace struct {
 	WriteCount     int64
 	WriteLatency   float64
 	PendingFlushes int64
+	Tables         []Table
+}
+
+//Table is a component of cfstats describing a single table (column family) within a keyspace
+type Table struct {
+	Name                      string
+	SSTableCount              int64
+	SpaceUsedLive             int64
+	SpaceUsedTotal            int64
+	SpaceUsedBySnapshots      int64
+	SSTableCompressionRatio   float64
+	MemtableCellCount         int64
+	MemtableDataSize          int64
+	LocalReadCount            int64
+	LocalReadLatency          float64
+	LocalWriteCount           int64
+	LocalWriteLatency         float64
+	PendingFlushes            int64
+	BloomFilterFalsePositives int64
+	BloomFilterFalseRatio     float64
+	BloomFilterSpaceUsed      int64
+	PartitionMinBytes         int64
+	PartitionMaxBytes         int64
+	PartitionMeanBytes        int64
+	AvgLiveCellsPerSlice      float64
+	MaxLiveCellsPerSlice      float64
+	AvgTombstonesPerSlice     float64
+	MaxTombstonesPerSlice     float64
+}
+
+//KeyspaceTable is a table along with the name of the keyspace it belongs to
+type KeyspaceTable struct {
+	Keyspace string
+	Table
 }
 
 //Info is the result of nodetool info
@@ -85,6 +279,7 @@ type Info struct {
 	ThriftActive          bool
 	NativeTransportActive bool
 	Load                  string
+	LoadBytes             int64
 	GenerationNo          int64
 	Uptime                int64
 	HeapUsage             float64
@@ -94,34 +289,401 @@ type Info struct {
 	KeyCache              Cache
 	RowCache              Cache
 	CounterCache          Cache
+	ChunkCache            Cache
+	PercentRepaired       float64
+}
+
+//MarshalJSON encodes the cache with NaN rates (i.e. no recent requests) as null as JSON has no NaN
+func (c Cache) MarshalJSON() ([]byte, error) {
+	type cache Cache
+	out := struct {
+		cache
+		RecentHitRate *float64
+		MissLatency   *float64
+	}{cache: cache(c)}
+	if !math.IsNaN(c.RecentHitRate) {
+		out.RecentHitRate = &c.RecentHitRate
+	}
+	if !math.IsNaN(c.MissLatency) {
+		out.MissLatency = &c.MissLatency
+	}
+	return json.Marshal(out)
+}
+
+//TpStats is the result of nodetool tpstats
+type TpStats struct {
+	ThreadPools     []ThreadPool
+	DroppedMessages []DroppedMessage
+}
+
+//ThreadPool is a component of nodetool tpstats
+type ThreadPool struct {
+	Name           string
+	Active         int64
+	Pending        int64
+	Completed      int64
+	Blocked        int64
+	AllTimeBlocked int64
+}
+
+//IsBacklogged returns true if the pool has pending or blocked tasks
+func (tp *ThreadPool) IsBacklogged() bool {
+	return tp.Pending > 0 || tp.Blocked > 0
+}
+
+//DroppedMessage is a component of nodetool tpstats
+type DroppedMessage struct {
+	Type    string
+	Dropped int64
+}
+
+//GcStats is the result of nodetool gcstats. Each call resets the node's counters so values cover the interval since
+//gcstats was last called.
+type GcStats struct {
+	IntervalMs     float64
+	MaxElapsedMs   float64
+	TotalElapsedMs float64
+	StdevElapsedMs float64
+	//ReclaimedBytes is labelled MB by nodetool but is reported in bytes
+	ReclaimedBytes    int64
+	Collections       int64
+	DirectMemoryBytes int64
+}
+
+//MarshalJSON encodes the gc stats with a NaN deviation (i.e. no collections) as null as JSON has no NaN
+func (g GcStats) MarshalJSON() ([]byte, error) {
+	type gcstats GcStats
+	out := struct {
+		gcstats
+		StdevElapsedMs *float64
+	}{gcstats: gcstats(g)}
+	if !math.IsNaN(g.StdevElapsedMs) {
+		out.StdevElapsedMs = &g.StdevElapsedMs
+	}
+	return json.Marshal(out)
+}
+
+//CompactionStats is the result of nodetool compactionstats
+type CompactionStats struct {
+	PendingTasks int64
+	Compactions  []Compaction
+}
+
+//Compaction is a component of nodetool compactionstats describing a running compaction
+type Compaction struct {
+	ID        string
+	Type      string
+	Keyspace  string
+	Table     string
+	Completed int64
+	Total     int64
+	Unit      string
+	Progress  float64
+}
+
+//ProxyHistograms is the result of nodetool proxyhistograms. All latencies are in microseconds.
+type ProxyHistograms struct {
+	Read      Percentiles
+	Write     Percentiles
+	Range     Percentiles
+	CASRead   Percentiles
+	CASWrite  Percentiles
+	ViewWrite Percentiles
+}
+
+//TableHistograms is the result of nodetool tablehistograms for a single table. Latencies are in microseconds and
+//partition sizes in bytes.
+type TableHistograms struct {
+	SSTables      Percentiles
+	WriteLatency  Percentiles
+	ReadLatency   Percentiles
+	PartitionSize Percentiles
+	CellCount     Percentiles
+}
+
+//Percentiles is a single column of a nodetool histogram
+type Percentiles struct {
+	P50 float64
+	P75 float64
+	P95 float64
+	P98 float64
+	P99 float64
+	Min float64
+	Max float64
+}
+
+//set stores the value of the named percentile row e.g. "95%" or "Max"
+func (p *Percentiles) set(percentile string, value float64) {
+	switch percentile {
+	case "50%":
+		p.P50 = value
+	case "75%":
+		p.P75 = value
+	case "95%":
+		p.P95 = value
+	case "98%":
+		p.P98 = value
+	case "99%":
+		p.P99 = value
+	case "Min":
+		p.Min = value
+	case "Max":
+		p.Max = value
+	}
+}
+
+//parseHistogramTable parses the percentile table shared by the histogram commands into columns keyed by their
+//header e.g. "Read Latency". Headers are right aligned with their values but are not always separated by more than
+//one space so each header is cut from the header line using the end offsets of the values in the first row.
+func parseHistogramTable(rawData string) map[string]*Percentiles {
+	header := ""
+	columns := make([]string, 0)
+	result := make(map[string]*Percentiles)
+
+	for _, line := range strings.Split(rawData, "\n") {
+		if regexp.MustCompile(`^\s*Percentile\s+`).MatchString(line) {
+			header = line
+			continue
+		}
+		if header == "" || !regexp.MustCompile(`^([0-9]+%|Min|Max)\s`).MatchString(line) {
+			continue
+		}
+
+		values := regexp.MustCompile(`\S+`).FindAllStringIndex(line, -1)
+		if len(columns) == 0 {
+			start := strings.Index(header, "Percentile") + len("Percentile")
+			for _, value := range values[1:] {
+				end := value[1]
+				if end > len(header) {
+					end = len(header)
+				}
+				column := ""
+				if start < end {
+					column = strings.TrimSpace(header[start:end])
+				}
+				columns = append(columns, column)
+				result[column] = &Percentiles{}
+				start = value[1]
+			}
+		}
+		if len(values) != len(columns)+1 {
+			continue
+		}
+		for i, column := range columns {
+			value, _ := strconv.ParseFloat(line[values[i+1][0]:values[i+1][1]], 64)
+			result[column].set(line[values[0][0]:values[0][1]], value)
+		}
+	}
+	return result
 }
 
 //Cache stores information on a cache e.g. RowCache
 type Cache struct {
 	Entries       int64
 	Size          string
+	SizeBytes     int64
 	Capacity      string
+	CapacityBytes int64
 	Hits          int64
 	Requests      int64
 	RecentHitRate float64
 	SavePeriod    int64
+	Misses        int64
+	MissLatency   float64
+}
+
+//DataSource is anything that can provide the typed results of nodetool commands
+type DataSource interface {
+	GetStatus() (Status, error)
+	GetCfStats() (CfStats, error)
+	GetInfo() (Info, error)
+	GetTpStats() (TpStats, error)
+	GetCompactionStats() (CompactionStats, error)
+	GetProxyHistograms() (ProxyHistograms, error)
+	GetTableHistograms(keyspace string, table string) (TableHistograms, error)
+	GetGcStats() (GcStats, error)
+}
+
+//ErrUnsupported is returned by a DataSource for a command it has no equivalent for. It is not reported as a failure.
+var ErrUnsupported = errors.New("not supported by this data source")
+
+//Executor runs a nodetool command and returns its raw output
+type Executor interface {
+	Execute(args ...string) (string, error)
+}
+
+//Connection holds the nodetool options for reaching JMX on another host or with authentication. The password is never
+//passed on the command line where it would be visible in the process listing, nodetool reads it from PasswordFile.
+type Connection struct {
+	Host     string
+	Port     int
+	Username string
+	//PasswordFile is a JMX password file e.g. one written by WritePasswordFile
+	PasswordFile string
+	SSL          bool
+}
+
+//args returns the nodetool options for the connection, they must come before the command
+func (c Connection) args() []string {
+	args := make([]string, 0)
+	if c.Host != "" {
+		args = append(args, "-h", c.Host)
+	}
+	if c.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(c.Port))
+	}
+	if c.Username != "" {
+		args = append(args, "-u", c.Username)
+	}
+	if c.PasswordFile != "" {
+		args = append(args, "-pwf", c.PasswordFile)
+	}
+	if c.SSL {
+		args = append(args, "--ssl")
+	}
+	return args
+}
+
+//WritePasswordFile writes credentials to a temporary file only readable by the current user in the JMX password file
+//format read by nodetool -pwf. The caller must remove the file once nodetool is no longer needed.
+func WritePasswordFile(username string, password string) (string, error) {
+	f, err := ioutil.TempFile("", "ntdash-jmx")
+	if err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintf(f, "%s %s\n", username, password); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+//CommandExecutor runs the nodetool binary. Commands running longer than the timeout are killed.
+type CommandExecutor struct {
+	//Path is the nodetool binary, nodetool is found on the PATH if empty
+	Path       string
+	Connection Connection
+	Timeout    time.Duration
+}
+
+func (e *CommandExecutor) Execute(args ...string) (string, error) {
+	ctx := context.Background()
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	path := e.Path
+	if path == "" {
+		path = "nodetool"
+	}
+
+	//errors only describe the command as the connection options name the password file
+	out, err := exec.CommandContext(ctx, path, append(e.Connection.args(), args...)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("nodetool %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("nodetool %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+//FixtureExecutor returns canned nodetool output keyed by the command arguments e.g. "status"
+type FixtureExecutor map[string]string
+
+func (e FixtureExecutor) Execute(args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	out, ok := e[command]
+	if !ok {
+		return "", fmt.Errorf("no fixture for nodetool %s", command)
+	}
+	return out, nil
 }
 
 //Nodetool provides acesss to nodetool data
 type Nodetool struct {
+	executor   Executor
+	mu         sync.Mutex
+	dialect    *Dialect
+	retryAt    time.Time
+	retryDelay time.Duration
+	Version    string
 }
 
-func (nt *Nodetool) Execute(args ...string) string {
-	out, err := exec.Command("nodetool", args...).Output()
-	if err != nil {
-		log.Fatal(err)
+//the delay before retrying version detection doubles after each failure between these limits
+const (
+	minDetectionRetry = 10 * time.Second
+	maxDetectionRetry = 5 * time.Minute
+)
+
+//getDialect detects the version of Cassandra on first use. If the version cannot be detected the oldest dialect is used
+//and detection is retried with a backoff so an unreachable node does not run nodetool version on every call.
+//Concurrent callers wait for a single detection.
+func (nt *Nodetool) getDialect() *Dialect {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	if nt.dialect != nil {
+		return nt.dialect
+	}
+	if time.Now().Before(nt.retryAt) {
+		return &dialects[0]
+	}
+	if out, err := nt.Execute("version"); err == nil {
+		if version, major, err := ParseVersion(out); err == nil {
+			nt.Version = version
+			nt.dialect = DialectForVersion(major)
+			return nt.dialect
+		}
+	}
+
+	nt.retryDelay *= 2
+	if nt.retryDelay < minDetectionRetry {
+		nt.retryDelay = minDetectionRetry
+	}
+	if nt.retryDelay > maxDetectionRetry {
+		nt.retryDelay = maxDetectionRetry
 	}
-	return string(out)
+	nt.retryAt = time.Now().Add(nt.retryDelay)
+	return &dialects[0]
+}
+
+func (nt *Nodetool) Execute(args ...string) (string, error) {
+	return nt.executor.Execute(args...)
 }
 
 //GetStatus returns nodetool status result
-func (nt *Nodetool) GetStatus() Status {
-	return nt.ParseStatus(nt.Execute("status"))
+func (nt *Nodetool) GetStatus() (Status, error) {
+	out, err := nt.Execute("status")
+	if err != nil {
+		return Status{}, err
+	}
+	return nt.getDialect().Parser.ParseStatus(out), nil
+}
+
+//splitAddress separates the port from a status address if it has one. The address may be an IPv4 or IPv6 address or a
+//resolved hostname e.g. "10.0.0.1:7000", "[2001:db8::1]:7000" or "cass-1.example.com".
+func splitAddress(address string) (host string, port string) {
+	if strings.HasPrefix(address, "[") {
+		if end := strings.Index(address, "]"); end > 0 {
+			return address[1:end], strings.TrimPrefix(address[end+1:], ":")
+		}
+		return address, ""
+	}
+
+	//a bare IPv6 address has more than one colon and no port
+	if strings.Count(address, ":") == 1 {
+		parts := strings.SplitN(address, ":", 2)
+		return parts[0], parts[1]
+	}
+	return address, ""
 }
 
 //ParseStatus parses a raw nodetool status output
@@ -144,12 +706,15 @@ func (nt *Nodetool) ParseStatus(rawStatus string) Status {
 			continue //without a DC we can't do much else
 		}
 
-		var nodePat = regexp.MustCompile(`^\s*([UD][NLJM])\s+([0-9]+\.[0-9]+\.[0-9]+\.[0-9]+)\s+([0-9\.]+ [PGMK]?B)\s+([0-9]+)\s+([0-9\?\.\%]+)\s+([a-zA-Z0-9\-]+)\s+(.+)$`)
+		var nodePat = regexp.MustCompile(`^\s*([UD][NLJM])\s+(\S+)\s+(` + sizePattern + `|\?)\s+([0-9]+)\s+([0-9\?\.\%]+)\s+([a-zA-Z0-9\-]+)\s+(.+)$`)
 		if nodeParts := nodePat.FindAllStringSubmatch(line, 7); nodeParts != nil {
 			if len(nodeParts[0]) != 8 {
 				continue
 			}
-			datacenters[len(datacenters)-1].Nodes = append(datacenters[len(datacenters)-1].Nodes, Node{State: nodeParts[0][1], Address: nodeParts[0][2], Load: nodeParts[0][3], Tokens: nodeParts[0][4], Owns: nodeParts[0][5], HostID: nodeParts[0][6], Rack: nodeParts[0][7]})
+			node := Node{State: nodeParts[0][1], Load: nodeParts[0][3], Tokens: nodeParts[0][4], Owns: nodeParts[0][5], HostID: nodeParts[0][6], Rack: nodeParts[0][7]}
+			node.Address, node.Port = splitAddress(nodeParts[0][2])
+			node.LoadBytes, _ = ParseBytes(node.Load)
+			datacenters[len(datacenters)-1].Nodes = append(datacenters[len(datacenters)-1].Nodes, node)
 			continue
 		}
 
@@ -158,8 +723,13 @@ func (nt *Nodetool) ParseStatus(rawStatus string) Status {
 	return Status{Datacenters: datacenters}
 }
 
-func (nt *Nodetool) GetCfStats() CfStats {
-	return nt.ParseCfStats(nt.Execute("cfstats"))
+func (nt *Nodetool) GetCfStats() (CfStats, error) {
+	dialect := nt.getDialect()
+	out, err := nt.Execute(dialect.CfStatsCommand)
+	if err != nil {
+		return CfStats{}, err
+	}
+	return dialect.Parser.ParseCfStats(out), nil
 }
 
 //ParseCfStats parses a raw cfstats output
@@ -176,6 +746,18 @@ func (nt *Nodetool) ParseCfStats(rawData string) CfStats {
 		}
 		curKeyspace := &keyspaces[len(keyspaces)-1]
 
+		//older versions call tables column families
+		if parts := regexp.MustCompile(`^\s*(?:Table|Table \(index\)|Column Family): (.+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+			curKeyspace.Tables = append(curKeyspace.Tables, Table{Name: parts[0][1]})
+			continue
+		}
+
+		//once a table has been seen all further stats belong to it
+		if len(curKeyspace.Tables) > 0 {
+			nt.parseTableLine(&curKeyspace.Tables[len(curKeyspace.Tables)-1], line)
+			continue
+		}
+
 		//parse keyspace stats
 		if parts := regexp.MustCompile(`^\s*Read Count: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
 			curKeyspace.ReadCount, _ = strconv.ParseInt(parts[0][1], 10, 64)
@@ -193,6 +775,55 @@ func (nt *Nodetool) ParseCfStats(rawData string) CfStats {
 	return CfStats{Keyspaces: keyspaces}
 }
 
+//parseTableLine updates a table with a single line of cfstats table output
+func (nt *Nodetool) parseTableLine(table *Table, line string) {
+	if parts := regexp.MustCompile(`^\s*SSTable count: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.SSTableCount, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Space used \(live\): ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.SpaceUsedLive, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Space used \(total\): ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.SpaceUsedTotal, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Space used by snapshots \(total\): ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.SpaceUsedBySnapshots, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*SSTable Compression Ratio: ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.SSTableCompressionRatio, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Memtable cell count: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.MemtableCellCount, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Memtable data size: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.MemtableDataSize, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Local read count: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.LocalReadCount, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Local read latency: ([0-9\.]+) ms$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.LocalReadLatency, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Local write count: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.LocalWriteCount, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Local write latency: ([0-9\.]+) ms$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.LocalWriteLatency, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Pending flushes: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.PendingFlushes, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Bloom filter false positives: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.BloomFilterFalsePositives, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Bloom filter false ratio: ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.BloomFilterFalseRatio, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Bloom filter space used: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.BloomFilterSpaceUsed, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Compacted partition minimum bytes: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.PartitionMinBytes, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Compacted partition maximum bytes: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.PartitionMaxBytes, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Compacted partition mean bytes: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.PartitionMeanBytes, _ = strconv.ParseInt(parts[0][1], 10, 64)
+	} else if parts := regexp.MustCompile(`^\s*Average live cells per slice \(last five minutes\): ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.AvgLiveCellsPerSlice, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Maximum live cells per slice \(last five minutes\): ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.MaxLiveCellsPerSlice, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Average tombstones per slice \(last five minutes\): ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.AvgTombstonesPerSlice, _ = strconv.ParseFloat(parts[0][1], 64)
+	} else if parts := regexp.MustCompile(`^\s*Maximum tombstones per slice \(last five minutes\): ([0-9\.]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		table.MaxTombstonesPerSlice, _ = strconv.ParseFloat(parts[0][1], 64)
+	}
+}
+
 func (nt *Nodetool) ParseInfo(rawData string) Info {
 
 	info := Info{}
@@ -206,8 +837,9 @@ func (nt *Nodetool) ParseInfo(rawData string) Info {
 			info.ThriftActive, _ = strconv.ParseBool(parts[0][1])
 		} else if parts := regexp.MustCompile(`^\s*Native Transport active\s*: (true|false)$`).FindAllStringSubmatch(line, 2); parts != nil {
 			info.NativeTransportActive, _ = strconv.ParseBool(parts[0][1])
-		} else if parts := regexp.MustCompile(`^\s*Load\s*: ([0-9\.]+ [KMGP]?B)$`).FindAllStringSubmatch(line, 2); parts != nil {
+		} else if parts := regexp.MustCompile(`^\s*Load\s*: (`+sizePattern+`)$`).FindAllStringSubmatch(line, 2); parts != nil {
 			info.Load = parts[0][1]
+			info.LoadBytes, _ = ParseBytes(info.Load)
 		} else if parts := regexp.MustCompile(`^\s*Generation No\s*: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
 			info.GenerationNo, _ = strconv.ParseInt(parts[0][1], 10, 64)
 		} else if parts := regexp.MustCompile(`^\s*Uptime \(seconds\)\s*: ([0-9]+)$`).FindAllStringSubmatch(line, 2); parts != nil {
@@ -226,6 +858,8 @@ func (nt *Nodetool) ParseInfo(rawData string) Info {
 
 		cacheDataToCache := func(data []string) Cache {
 			cache := Cache{Size: data[2], Capacity: data[3]}
+			cache.SizeBytes, _ = ParseBytes(cache.Size)
+			cache.CapacityBytes, _ = ParseBytes(cache.Capacity)
 			cache.Entries, _ = strconv.ParseInt(data[1], 10, 64)
 			cache.Hits, _ = strconv.ParseInt(data[4], 10, 64)
 			cache.Requests, _ = strconv.ParseInt(data[5], 10, 64)
@@ -254,11 +888,174 @@ func (nt *Nodetool) ParseInfo(rawData string) Info {
 	return info
 }
 
-func (nt *Nodetool) GetInfo() Info {
-	return nt.ParseInfo(nt.Execute("info"))
+func (nt *Nodetool) GetInfo() (Info, error) {
+	out, err := nt.Execute("info")
+	if err != nil {
+		return Info{}, err
+	}
+	return nt.getDialect().Parser.ParseInfo(out), nil
+}
+
+func (nt *Nodetool) GetTpStats() (TpStats, error) {
+	out, err := nt.Execute("tpstats")
+	if err != nil {
+		return TpStats{}, err
+	}
+	return nt.getDialect().Parser.ParseTpStats(out), nil
+}
+
+//ParseTpStats parses a raw nodetool tpstats output
+func (nt *Nodetool) ParseTpStats(rawData string) TpStats {
+	tpstats := TpStats{ThreadPools: make([]ThreadPool, 0), DroppedMessages: make([]DroppedMessage, 0)}
+
+	inDropped := false
+	for _, line := range strings.Split(rawData, "\n") {
+		if regexp.MustCompile(`^\s*Message type\s+Dropped`).MatchString(line) {
+			inDropped = true
+			continue
+		}
+
+		if inDropped {
+			if parts := regexp.MustCompile(`^\s*([A-Z_]+)\s+([0-9]+)`).FindAllStringSubmatch(line, 3); parts != nil {
+				msg := DroppedMessage{Type: parts[0][1]}
+				msg.Dropped, _ = strconv.ParseInt(parts[0][2], 10, 64)
+				tpstats.DroppedMessages = append(tpstats.DroppedMessages, msg)
+			}
+			continue
+		}
+
+		//some pools report n/a for blocked tasks
+		if parts := regexp.MustCompile(`^\s*([a-zA-Z0-9_\-]+)\s+([0-9]+)\s+([0-9]+)\s+([0-9]+)\s+([0-9]+|n/a)\s+([0-9]+|n/a)\s*$`).FindAllStringSubmatch(line, 7); parts != nil {
+			pool := ThreadPool{Name: parts[0][1]}
+			pool.Active, _ = strconv.ParseInt(parts[0][2], 10, 64)
+			pool.Pending, _ = strconv.ParseInt(parts[0][3], 10, 64)
+			pool.Completed, _ = strconv.ParseInt(parts[0][4], 10, 64)
+			pool.Blocked, _ = strconv.ParseInt(parts[0][5], 10, 64)
+			pool.AllTimeBlocked, _ = strconv.ParseInt(parts[0][6], 10, 64)
+			tpstats.ThreadPools = append(tpstats.ThreadPools, pool)
+		}
+	}
+
+	return tpstats
+}
+
+func (nt *Nodetool) GetCompactionStats() (CompactionStats, error) {
+	out, err := nt.Execute("compactionstats")
+	if err != nil {
+		return CompactionStats{}, err
+	}
+	return nt.getDialect().Parser.ParseCompactionStats(out), nil
+}
+
+//ParseCompactionStats parses a raw nodetool compactionstats output
+func (nt *Nodetool) ParseCompactionStats(rawData string) CompactionStats {
+	stats := CompactionStats{Compactions: make([]Compaction, 0)}
+
+	for _, line := range strings.Split(rawData, "\n") {
+		if parts := regexp.MustCompile(`^\s*pending tasks:?\s+([0-9]+)`).FindAllStringSubmatch(line, 2); parts != nil {
+			stats.PendingTasks, _ = strconv.ParseInt(parts[0][1], 10, 64)
+			continue
+		}
+
+		//the id column was added in 2.2 and the compaction type may contain spaces e.g. "Tombstone Compaction"
+		if parts := regexp.MustCompile(`^\s*(?:([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\s+)?(\S.*?)\s+(\S+)\s+(\S+)\s+([0-9]+)\s+([0-9]+)\s+(\S+)\s+([0-9\.]+)%\s*$`).FindAllStringSubmatch(line, 9); parts != nil {
+			compaction := Compaction{ID: parts[0][1], Type: parts[0][2], Keyspace: parts[0][3], Table: parts[0][4], Unit: parts[0][7]}
+			compaction.Completed, _ = strconv.ParseInt(parts[0][5], 10, 64)
+			compaction.Total, _ = strconv.ParseInt(parts[0][6], 10, 64)
+			compaction.Progress, _ = strconv.ParseFloat(parts[0][8], 64)
+			stats.Compactions = append(stats.Compactions, compaction)
+		}
+	}
+
+	return stats
+}
+
+func (nt *Nodetool) GetProxyHistograms() (ProxyHistograms, error) {
+	out, err := nt.Execute("proxyhistograms")
+	if err != nil {
+		return ProxyHistograms{}, err
+	}
+	return nt.getDialect().Parser.ParseProxyHistograms(out), nil
+}
+
+//ParseProxyHistograms parses a raw nodetool proxyhistograms output. Columns missing from older versions are left empty.
+func (nt *Nodetool) ParseProxyHistograms(rawData string) ProxyHistograms {
+	histograms := ProxyHistograms{}
+	columns := map[string]*Percentiles{
+		"Read Latency":       &histograms.Read,
+		"Write Latency":      &histograms.Write,
+		"Range Latency":      &histograms.Range,
+		"CAS Read Latency":   &histograms.CASRead,
+		"CAS Write Latency":  &histograms.CASWrite,
+		"View Write Latency": &histograms.ViewWrite,
+	}
+	for name, percentiles := range parseHistogramTable(rawData) {
+		if column, ok := columns[name]; ok {
+			*column = *percentiles
+		}
+	}
+	return histograms
+}
+
+func (nt *Nodetool) GetTableHistograms(keyspace string, table string) (TableHistograms, error) {
+	dialect := nt.getDialect()
+	out, err := nt.Execute(dialect.TableHistogramsCommand, keyspace, table)
+	if err != nil {
+		return TableHistograms{}, err
+	}
+	return dialect.Parser.ParseTableHistograms(out), nil
+}
+
+//ParseTableHistograms parses a raw nodetool tablehistograms (or cfhistograms) output
+func (nt *Nodetool) ParseTableHistograms(rawData string) TableHistograms {
+	histograms := TableHistograms{}
+	columns := map[string]*Percentiles{
+		"SSTables":       &histograms.SSTables,
+		"Write Latency":  &histograms.WriteLatency,
+		"Read Latency":   &histograms.ReadLatency,
+		"Partition Size": &histograms.PartitionSize,
+		"Cell Count":     &histograms.CellCount,
+	}
+	for name, percentiles := range parseHistogramTable(rawData) {
+		if column, ok := columns[name]; ok {
+			*column = *percentiles
+		}
+	}
+	return histograms
+}
+
+func (nt *Nodetool) GetGcStats() (GcStats, error) {
+	out, err := nt.Execute("gcstats")
+	if err != nil {
+		return GcStats{}, err
+	}
+	return nt.getDialect().Parser.ParseGcStats(out), nil
+}
+
+//ParseGcStats parses a raw nodetool gcstats output. The header columns are not reliably separated so only the row of
+//values is parsed.
+func (nt *Nodetool) ParseGcStats(rawData string) GcStats {
+	gcstats := GcStats{}
+	for _, line := range strings.Split(rawData, "\n") {
+		if parts := regexp.MustCompile(`^\s*([0-9.]+)\s+([0-9.]+)\s+([0-9.]+)\s+(\S+)\s+(-?[0-9]+)\s+([0-9]+)\s+(-?[0-9]+)\s*$`).FindStringSubmatch(line); parts != nil {
+			gcstats.IntervalMs, _ = strconv.ParseFloat(parts[1], 64)
+			gcstats.MaxElapsedMs, _ = strconv.ParseFloat(parts[2], 64)
+			gcstats.TotalElapsedMs, _ = strconv.ParseFloat(parts[3], 64)
+			gcstats.StdevElapsedMs, _ = strconv.ParseFloat(parts[4], 64)
+			gcstats.ReclaimedBytes, _ = strconv.ParseInt(parts[5], 10, 64)
+			gcstats.Collections, _ = strconv.ParseInt(parts[6], 10, 64)
+			gcstats.DirectMemoryBytes, _ = strconv.ParseInt(parts[7], 10, 64)
+		}
+	}
+	return gcstats
+}
+
+//NewNodetool constructs a new nodetool instance that runs the local nodetool binary
+func NewNodetool() *Nodetool {
+	return NewNodetoolWithExecutor(&CommandExecutor{})
 }
 
-//NewNodetool constructs a new nodetool instance
-func NewNodetool() Nodetool {
-	return Nodetool{}
+//NewNodetoolWithExecutor constructs a new nodetool instance with an alternative executor
+func NewNodetoolWithExecutor(executor Executor) *Nodetool {
+	return &Nodetool{executor: executor}
 }
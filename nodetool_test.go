@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -283,6 +287,10 @@ func TestParseInfo(t *testing.T) {
 		t.Error("Load is incorrect", info.Load)
 	}
 
+	if info.LoadBytes != 52731460976 {
+		t.Error("LoadBytes is incorrect", info.LoadBytes)
+	}
+
 	if info.GenerationNo != 1422527983 {
 		t.Error("GenerationNo is incorrect", info.GenerationNo)
 	}
@@ -319,6 +327,10 @@ func TestParseInfo(t *testing.T) {
 		t.Error("KeyCache.Size is incorrect", info.KeyCache.Capacity)
 	}
 
+	if info.KeyCache.SizeBytes != 68209868 || info.KeyCache.CapacityBytes != 104857600 {
+		t.Error("KeyCache byte sizes are incorrect", info.KeyCache.SizeBytes, info.KeyCache.CapacityBytes)
+	}
+
 	if info.KeyCache.Hits != 23999063 {
 		t.Error("KeyCache.Size is incorrect", info.KeyCache.Hits)
 	}
@@ -363,3 +375,376 @@ func TestParseInfo(t *testing.T) {
 		t.Error("RowCache.SavePeriod is incorrect", info.RowCache.SavePeriod)
 	}
 }
+
+func TestParseTpStats(t *testing.T) {
+	rawData := `Pool Name                    Active   Pending      Completed   Blocked  All time blocked
+MutationStage                     2        15      205678383         0                 0
+ReadStage                         0         0        3541478         0                 0
+RequestResponseStage              0         0      134570213         0                 0
+ReadRepairStage                   0         0          14521         0                 0
+CounterMutationStage              0         0              0         0                 0
+MiscStage                         0         0              0         0                 0
+HintedHandoff                     0         0            120         0                 0
+GossipStage                       0         0        5398871         0                 0
+CacheCleanupExecutor              0         0              0         0                 0
+InternalResponseStage             0         0              0         0                 0
+CommitLogArchiver                 0         0              0         0                 0
+CompactionExecutor                1         4         310021       n/a                 0
+ValidationExecutor                0         0              0         0                 0
+MigrationStage                    0         0             12         0                 0
+AntiEntropyStage                  0         0              0         0                 0
+PendingRangeCalculator            0         0             33         0                 0
+Sampler                           0         0              0         0                 0
+MemtableFlushWriter               0         0          11328         0                 0
+MemtablePostFlush                 0         0          20154         0                 0
+MemtableReclaimMemory             0         0          11328         0                 0
+Native-Transport-Requests         4         0      472398812         3              2201
+
+Message type           Dropped
+READ                         0
+RANGE_SLICE                  0
+_TRACE                       0
+MUTATION                   417
+COUNTER_MUTATION             0
+BINARY                       0
+REQUEST_RESPONSE             0
+PAGED_RANGE                  0
+READ_REPAIR                  0`
+
+	nt := NewNodetool()
+	tpstats := nt.ParseTpStats(rawData)
+
+	if len(tpstats.ThreadPools) != 21 {
+		t.Error("Expected 21 thread pools. Actually ", len(tpstats.ThreadPools))
+		return
+	}
+
+	mutation := tpstats.ThreadPools[0]
+	if mutation.Name != "MutationStage" || mutation.Active != 2 || mutation.Pending != 15 || mutation.Completed != 205678383 || mutation.Blocked != 0 || mutation.AllTimeBlocked != 0 {
+		t.Error("MutationStage is incorrect", mutation)
+	}
+	if !mutation.IsBacklogged() {
+		t.Error("MutationStage should be backlogged")
+	}
+
+	compaction := tpstats.ThreadPools[11]
+	if compaction.Name != "CompactionExecutor" || compaction.Pending != 4 || compaction.Blocked != 0 {
+		t.Error("CompactionExecutor is incorrect", compaction)
+	}
+
+	native := tpstats.ThreadPools[20]
+	if native.Name != "Native-Transport-Requests" || native.Blocked != 3 || native.AllTimeBlocked != 2201 {
+		t.Error("Native-Transport-Requests is incorrect", native)
+	}
+
+	if len(tpstats.DroppedMessages) != 9 {
+		t.Error("Expected 9 dropped message types. Actually ", len(tpstats.DroppedMessages))
+		return
+	}
+
+	if tpstats.DroppedMessages[3].Type != "MUTATION" || tpstats.DroppedMessages[3].Dropped != 417 {
+		t.Error("MUTATION dropped is incorrect", tpstats.DroppedMessages[3])
+	}
+}
+
+func TestParseCfStatsTables(t *testing.T) {
+	rawData := `Keyspace: ks1
+    Read Count: 100
+    Read Latency: 0.5 ms.
+    Write Count: 200
+    Write Latency: 0.1 ms.
+    Pending Flushes: 0
+        Table: users
+        SSTable count: 12
+        Space used (live): 104857600
+        Space used (total): 209715200
+        Space used by snapshots (total): 1024
+        SSTable Compression Ratio: 0.35
+        Memtable cell count: 520
+        Memtable data size: 4096
+        Memtable switch count: 3
+        Local read count: 80
+        Local read latency: 0.612 ms
+        Local write count: 150
+        Local write latency: 0.021 ms
+        Pending flushes: 1
+        Bloom filter false positives: 7
+        Bloom filter false ratio: 0.00125
+        Bloom filter space used: 2048
+        Compacted partition minimum bytes: 61
+        Compacted partition maximum bytes: 5839588
+        Compacted partition mean bytes: 1024
+        Average live cells per slice (last five minutes): 2.5
+        Maximum live cells per slice (last five minutes): 10.0
+        Average tombstones per slice (last five minutes): 1.5
+        Maximum tombstones per slice (last five minutes): 42.0
+
+        Table: events
+        SSTable count: 3
+        Local read latency: NaN ms
+        Pending flushes: 0
+----------------
+Keyspace: ks2
+    Read Count: 0
+    Read Latency: NaN ms.
+    Write Count: 0
+    Write Latency: NaN ms.
+    Pending Flushes: 4
+        Column Family: legacy
+        SSTable count: 1`
+
+	nt := NewNodetool()
+	stats := nt.ParseCfStats(rawData)
+
+	if len(stats.Keyspaces) != 2 || len(stats.Keyspaces[0].Tables) != 2 || len(stats.Keyspaces[1].Tables) != 1 {
+		t.Error("Tables were not nested under their keyspaces", stats.Keyspaces)
+		return
+	}
+
+	if stats.Keyspaces[0].PendingFlushes != 0 || stats.Keyspaces[1].PendingFlushes != 4 {
+		t.Error("Table stats leaked into keyspace stats", stats.Keyspaces[0].PendingFlushes, stats.Keyspaces[1].PendingFlushes)
+	}
+
+	expected := Table{
+		Name:                      "users",
+		SSTableCount:              12,
+		SpaceUsedLive:             104857600,
+		SpaceUsedTotal:            209715200,
+		SpaceUsedBySnapshots:      1024,
+		SSTableCompressionRatio:   0.35,
+		MemtableCellCount:         520,
+		MemtableDataSize:          4096,
+		LocalReadCount:            80,
+		LocalReadLatency:          0.612,
+		LocalWriteCount:           150,
+		LocalWriteLatency:         0.021,
+		PendingFlushes:            1,
+		BloomFilterFalsePositives: 7,
+		BloomFilterFalseRatio:     0.00125,
+		BloomFilterSpaceUsed:      2048,
+		PartitionMinBytes:         61,
+		PartitionMaxBytes:         5839588,
+		PartitionMeanBytes:        1024,
+		AvgLiveCellsPerSlice:      2.5,
+		MaxLiveCellsPerSlice:      10.0,
+		AvgTombstonesPerSlice:     1.5,
+		MaxTombstonesPerSlice:     42.0,
+	}
+	if stats.Keyspaces[0].Tables[0] != expected {
+		t.Errorf("Table users is incorrect %+v", stats.Keyspaces[0].Tables[0])
+	}
+
+	if stats.Keyspaces[0].Tables[1].Name != "events" || stats.Keyspaces[0].Tables[1].SSTableCount != 3 {
+		t.Errorf("Table events is incorrect %+v", stats.Keyspaces[0].Tables[1])
+	}
+
+	if stats.Keyspaces[1].Tables[0].Name != "legacy" || stats.Keyspaces[1].Tables[0].SSTableCount != 1 {
+		t.Errorf("Column family legacy is incorrect %+v", stats.Keyspaces[1].Tables[0])
+	}
+
+	tables := stats.GetTables()
+	if len(tables) != 3 || tables[2].Keyspace != "ks2" || tables[2].Name != "legacy" {
+		t.Error("GetTables is incorrect", tables)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"0 bytes":   0,
+		"512 bytes": 512,
+		"100 B":     100,
+		"1 KB":      1024,
+		"1.5 KiB":   1536,
+		"65.05 MB":  68209868,
+		"2 MiB":     2097152,
+		"35.32 GB":  37924561223,
+		"1 GiB":     1073741824,
+		"1.5 TB":    1649267441664,
+		"2 TiB":     2199023255552,
+		"1 PB":      1125899906842624,
+	}
+	for size, expected := range cases {
+		if bytes, err := ParseBytes(size); err != nil || bytes != expected {
+			t.Error("ParseBytes is incorrect for", size, bytes, err)
+		}
+	}
+
+	for _, size := range []string{"", "?", "12", "1 XB", "a GB"} {
+		if _, err := ParseBytes(size); err == nil {
+			t.Error("Expected an error for", size)
+		}
+	}
+
+	if FormatBytes(512) != "512 bytes" || FormatBytes(37924561223) != "35.32 GB" || FormatBytes(1649267441664) != "1.50 TB" {
+		t.Error("FormatBytes is incorrect", FormatBytes(512), FormatBytes(37924561223), FormatBytes(1649267441664))
+	}
+}
+
+func TestParseStatusLoad(t *testing.T) {
+	rawStatus := `Datacenter: DC1
+===============
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address    Load       Tokens  Owns (effective)  Host ID                               Rack
+UN  10.0.0.1   1.5 TiB    256     34.2%             99ca9b90-ba59-4411-be56-aafcabedc9c6  r1
+UN  10.0.0.2   512 KiB    256     32.1%             4da97bcf-9831-438b-863c-8a15a19a904e  r1
+Datacenter: DC2
+===============
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address    Load       Tokens  Owns (effective)  Host ID                               Rack
+UJ  10.1.0.1   0 bytes    256     ?                 f62dd765-2fa8-49b2-8cc2-e10a3b90680b  r2
+UN  10.1.0.2   1 TB       256     33.7%             76881341-7f76-4ef8-b254-c446245830ca  r2`
+
+	nt := NewNodetool()
+	status := nt.ParseStatus(rawStatus)
+
+	if len(status.Datacenters) != 2 || len(status.Datacenters[0].Nodes) != 2 || len(status.Datacenters[1].Nodes) != 2 {
+		t.Fatal("Expected all nodes to be parsed", status.Datacenters)
+	}
+	if status.Datacenters[0].Nodes[0].Load != "1.5 TiB" || status.Datacenters[0].Nodes[0].LoadBytes != 1649267441664 {
+		t.Error("Node load is incorrect", status.Datacenters[0].Nodes[0])
+	}
+	if status.Datacenters[0].GetLoadBytes() != 1649267441664+524288 {
+		t.Error("DC1 load is incorrect", status.Datacenters[0].GetLoadBytes())
+	}
+	if status.GetLoadBytes() != 1649267441664+524288+1099511627776 {
+		t.Error("Total load is incorrect", status.GetLoadBytes())
+	}
+}
+
+func TestParseStatusAddresses(t *testing.T) {
+	rawStatus := `Datacenter: datacenter1
+=======================
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address                 Load       Tokens  Owns (effective)  Host ID                               Rack
+UN  10.0.0.1                1.2 GiB    16      25.0%             99ca9b90-ba59-4411-be56-aafcabedc9c6  rack1
+UN  10.0.0.2:7000           1.3 GiB    16      25.0%             4da97bcf-9831-438b-863c-8a15a19a904e  rack1
+UN  2001:db8::1             1.4 GiB    16      25.0%             f62dd765-2fa8-49b2-8cc2-e10a3b90680b  rack1
+UN  [2001:db8::2]:7000      1.5 GiB    16      25.0%             76881341-7f76-4ef8-b254-c446245830ca  rack1
+DN  fe80::1%eth0            ?          16      ?                 8450f8ec-f8c0-4b89-b9e2-67c88cda87b2  rack1
+UN  cass-1.example.com      1.6 GiB    16      ?                 bebf7e78-1376-411f-be27-60deae5af0b6  rack1
+UL  cass-2.example.com:7000 1.7 GiB    16      ?                 283be4bb-20ad-428a-a6c0-04389b750ada  rack1`
+
+	nt := NewNodetool()
+	status := nt.ParseStatus(rawStatus)
+
+	if len(status.Datacenters) != 1 || len(status.Datacenters[0].Nodes) != 7 {
+		t.Fatal("Expected all 7 nodes to be parsed", status.Datacenters)
+	}
+
+	expected := []struct {
+		address string
+		port    string
+	}{
+		{"10.0.0.1", ""},
+		{"10.0.0.2", "7000"},
+		{"2001:db8::1", ""},
+		{"2001:db8::2", "7000"},
+		{"fe80::1%eth0", ""},
+		{"cass-1.example.com", ""},
+		{"cass-2.example.com", "7000"},
+	}
+	for i, node := range status.Datacenters[0].Nodes {
+		if node.Address != expected[i].address || node.Port != expected[i].port {
+			t.Errorf("Node %d address is incorrect %s %s", i, node.Address, node.Port)
+		}
+	}
+
+	down := status.Datacenters[0].Nodes[4]
+	if down.State != "DN" || down.Load != "?" || down.LoadBytes != 0 || down.HostID != "8450f8ec-f8c0-4b89-b9e2-67c88cda87b2" {
+		t.Errorf("Down node is incorrect %+v", down)
+	}
+
+	if status.GetPcntUpNormal() != 71 {
+		t.Error("Percent up normal is incorrect", status.GetPcntUpNormal())
+	}
+
+	empty := nt.ParseStatus("")
+	if empty.GetPcntUpNormal() != 0 {
+		t.Error("Percent up normal of an empty cluster is incorrect", empty.GetPcntUpNormal())
+	}
+}
+
+func TestCfStatsWeightedLatency(t *testing.T) {
+	cfstats := CfStats{Keyspaces: []Keyspace{
+		{Name: "ks1", ReadCount: 300, ReadLatency: 1.0, WriteCount: 100, WriteLatency: 0.5},
+		{Name: "ks2", ReadCount: 100, ReadLatency: 5.0, WriteCount: 0, WriteLatency: 9.0},
+		{Name: "system_traces", ReadCount: 0, ReadLatency: math.NaN(), WriteCount: 100, WriteLatency: 1.5},
+	}}
+
+	if latency := cfstats.GetAvgReadLatency(); latency != 2.0 {
+		t.Error("Read latency should be weighted by read count", latency)
+	}
+	if latency := cfstats.GetAvgWriteLatency(); latency != 1.0 {
+		t.Error("Write latency should be weighted by write count", latency)
+	}
+
+	//only the requests since the previous stats count, ks1 served no reads and system_traces no writes since then
+	prev := map[string]Keyspace{
+		"ks1":           {ReadCount: 300, WriteCount: 0},
+		"ks2":           {ReadCount: 50},
+		"system_traces": {WriteCount: 100},
+	}
+	if latency := cfstats.GetRecentReadLatency(prev); latency != 5.0 {
+		t.Error("Read latency should be weighted by recent reads", latency)
+	}
+	if latency := cfstats.GetRecentWriteLatency(prev); latency != 0.5 {
+		t.Error("Write latency should be weighted by recent writes", latency)
+	}
+
+	user := cfstats.WithoutSystemKeyspaces()
+	if len(user.Keyspaces) != 2 || user.GetAvgWriteLatency() != 0.5 {
+		t.Error("System keyspaces were not excluded", user)
+	}
+
+	empty := CfStats{}
+	if empty.GetAvgReadLatency() != 0 || empty.GetAvgWriteLatency() != 0 {
+		t.Error("Expected no latency without keyspaces")
+	}
+}
+
+func TestCommandExecutorConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ntdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the fake nodetool prints its arguments
+	path := filepath.Join(dir, "nodetool")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	passwordFile, err := WritePasswordFile("cassandra", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(passwordFile)
+	if stat, err := os.Stat(passwordFile); err != nil || stat.Mode().Perm() != 0600 {
+		t.Error("Expected the password file to be private", stat.Mode(), err)
+	}
+	if raw, _ := ioutil.ReadFile(passwordFile); string(raw) != "cassandra s3cret\n" {
+		t.Error("Password file is incorrect", string(raw))
+	}
+
+	executor := &CommandExecutor{Path: path, Connection: Connection{Host: "10.0.0.1", Port: 7199, Username: "cassandra", PasswordFile: passwordFile, SSL: true}}
+	out, err := executor.Execute("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "-h 10.0.0.1 -p 7199 -u cassandra -pwf " + passwordFile + " --ssl status"; strings.TrimSpace(out) != expected {
+		t.Error("Connection options are incorrect", out)
+	}
+	if strings.Contains(out, "s3cret") {
+		t.Error("Expected the password not to be passed as an argument", out)
+	}
+
+	//errors describe the command without the connection options
+	executor.Path = filepath.Join(dir, "missing")
+	if _, err := executor.Execute("info"); err == nil || strings.Contains(err.Error(), "pwf") || !strings.HasPrefix(err.Error(), "nodetool info") {
+		t.Error("Expected the error to only describe the command", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Recording is a single nodetool command saved by a RecordingExecutor
+type Recording struct {
+	At     time.Time
+	Args   []string
+	Output string
+	Error  string `json:",omitempty"`
+}
+
+//RecordingExecutor runs commands with the wrapped executor and writes each result to w as a line of JSON
+type RecordingExecutor struct {
+	Executor
+	w   io.Writer
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+//NewRecordingExecutor constructs an executor recording every command run by executor to w
+func NewRecordingExecutor(executor Executor, w io.Writer) *RecordingExecutor {
+	return &RecordingExecutor{Executor: executor, w: w, now: time.Now}
+}
+
+func (e *RecordingExecutor) Execute(args ...string) (string, error) {
+	out, err := e.Executor.Execute(args...)
+
+	recording := Recording{At: e.now(), Args: args, Output: out}
+	if err != nil {
+		recording.Error = err.Error()
+	}
+	line, marshalErr := json.Marshal(recording)
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, writeErr := e.w.Write(append(line, '\n')); writeErr != nil {
+		return "", fmt.Errorf("failed to record nodetool %s: %v", strings.Join(args, " "), writeErr)
+	}
+	return out, err
+}
+
+//ReplayExecutor plays back the commands saved by a RecordingExecutor. The replay starts at the first recording and
+//advances with the wall clock multiplied by the speed. Each command returns the output most recently recorded for it
+//at the current point in the replay and the last outputs are repeated once the replay ends.
+type ReplayExecutor struct {
+	recordings map[string][]Recording
+	start      time.Time
+	end        time.Time
+	speed      float64
+	began      time.Time
+	wallClock  func() time.Time
+}
+
+//NewReplayExecutor constructs an executor replaying the recordings read from r at the given speed e.g. 2 for twice
+//as fast as they were recorded
+func NewReplayExecutor(r io.Reader, speed float64) (*ReplayExecutor, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("replay speed must be positive, got %v", speed)
+	}
+
+	e := &ReplayExecutor{recordings: make(map[string][]Recording), speed: speed, wallClock: time.Now}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		recording := Recording{}
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, fmt.Errorf("invalid recording: %v", err)
+		}
+		command := strings.Join(recording.Args, " ")
+		e.recordings[command] = append(e.recordings[command], recording)
+
+		if e.start.IsZero() || recording.At.Before(e.start) {
+			e.start = recording.At
+		}
+		if recording.At.After(e.end) {
+			e.end = recording.At
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(e.recordings) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+
+	for _, recordings := range e.recordings {
+		sort.SliceStable(recordings, func(i, j int) bool { return recordings[i].At.Before(recordings[j].At) })
+	}
+	e.began = e.wallClock()
+	return e, nil
+}
+
+//Now returns the current point in the replay as the time it was recorded
+func (e *ReplayExecutor) Now() time.Time {
+	elapsed := time.Duration(float64(e.wallClock().Sub(e.began)) * e.speed)
+	if now := e.start.Add(elapsed); now.Before(e.end) {
+		return now
+	}
+	return e.end
+}
+
+//Done returns true once the replay has reached the last recording
+func (e *ReplayExecutor) Done() bool {
+	return !e.Now().Before(e.end)
+}
+
+func (e *ReplayExecutor) Execute(args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	recordings, ok := e.recordings[command]
+	if !ok {
+		return "", fmt.Errorf("nodetool %s was not recorded", command)
+	}
+
+	now := e.Now()
+	idx := sort.Search(len(recordings), func(i int) bool { return recordings[i].At.After(now) }) - 1
+	if idx < 0 {
+		return "", fmt.Errorf("nodetool %s was not recorded until %s", command, recordings[0].At.Format(time.RFC3339))
+	}
+	if recordings[idx].Error != "" {
+		return recordings[idx].Output, errors.New(recordings[idx].Error)
+	}
+	return recordings[idx].Output, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	fixtures := FixtureExecutor{}
+
+	buf := &bytes.Buffer{}
+	recorder := NewRecordingExecutor(fixtures, buf)
+	for i := 0; i < 3; i++ {
+		recorder.now = func() time.Time { return start.Add(time.Duration(i) * 10 * time.Second) }
+		fixtures["info"] = fmt.Sprintf("Exceptions : %d", i+1)
+		if _, err := recorder.Execute("info"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder.now = func() time.Time { return start.Add(25 * time.Second) }
+	if _, err := recorder.Execute("status"); err == nil {
+		t.Fatal("Expected the missing fixture to fail")
+	}
+
+	replayer, err := NewReplayExecutor(buf, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wall := replayer.began
+	replayer.wallClock = func() time.Time { return wall }
+
+	if out, _ := replayer.Execute("info"); out != "Exceptions : 1" {
+		t.Error("Expected the first recording at the start of the replay", out)
+	}
+	//the initial samples are timestamped with the recorded time rather than the wall-clock time
+	collector := NewCollectorWithClock(NewNodetoolWithExecutor(replayer), 10, replayer.Now)
+	if at := collector.Data.Snapshot().Series["heap_usage"].Last().At; !at.Equal(start) {
+		t.Error("Expected the initial sample at the start of the replay", at)
+	}
+	if _, err := replayer.Execute("status"); err == nil || !strings.Contains(err.Error(), "not recorded until") {
+		t.Error("Expected status to be unavailable before it was recorded", err)
+	}
+
+	//one second at x10 is ten seconds into the recording
+	wall = wall.Add(time.Second)
+	if out, _ := replayer.Execute("info"); out != "Exceptions : 2" || !replayer.Now().Equal(start.Add(10*time.Second)) {
+		t.Error("Expected the replay to advance at ten times the speed", out, replayer.Now())
+	}
+
+	wall = wall.Add(time.Hour)
+	if !replayer.Done() {
+		t.Error("Expected the replay to have finished")
+	}
+
+	//collection stops once the replay has finished rather than repeating the last samples
+	collector.Done = replayer.Done
+	stopped := make(chan struct{})
+	go func() {
+		collector.Run(context.Background(), time.Millisecond)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the collector to stop at the end of the replay")
+	}
+	if heap := (<-collector.Snapshots()).Series["heap_usage"]; heap.Len() != 2 {
+		t.Error("Expected a single collection after the replay finished", heap.Values())
+	}
+	if out, _ := replayer.Execute("info"); out != "Exceptions : 3" {
+		t.Error("Expected the last recording to be repeated", out)
+	}
+	if _, err := replayer.Execute("status"); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Error("Expected the recorded error to be replayed", err)
+	}
+	if _, err := replayer.Execute("tpstats"); err == nil {
+		t.Error("Expected an error for a command that was never recorded")
+	}
+}
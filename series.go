@@ -0,0 +1,93 @@
+package main
+
+import "time"
+
+//Sample is a single timestamped value in a Series
+type Sample struct {
+	At    time.Time
+	Value float64
+}
+
+//Series is a timeseries holding a fixed number of the most recent samples. Once full each new sample overwrites
+//the oldest.
+type Series struct {
+	samples []Sample
+	start   int
+	size    int
+	//sink is called with every sample added e.g. to persist it
+	sink func(Sample)
+}
+
+//NewSeries constructs an empty series holding up to capacity samples
+func NewSeries(capacity int) *Series {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Series{samples: make([]Sample, capacity)}
+}
+
+//Add appends a sample, dropping the oldest sample if the series is full
+func (s *Series) Add(at time.Time, value float64) {
+	if s.sink != nil {
+		s.sink(Sample{At: at, Value: value})
+	}
+	if s.size < len(s.samples) {
+		s.samples[(s.start+s.size)%len(s.samples)] = Sample{At: at, Value: value}
+		s.size++
+		return
+	}
+	s.samples[s.start] = Sample{At: at, Value: value}
+	s.start = (s.start + 1) % len(s.samples)
+}
+
+//Clear removes every sample
+func (s *Series) Clear() {
+	s.start, s.size = 0, 0
+}
+
+//Copy returns an independent copy of the series. Samples added to the copy are not passed to the sink.
+func (s *Series) Copy() *Series {
+	samples := make([]Sample, len(s.samples))
+	copy(samples, s.samples)
+	return &Series{samples: samples, start: s.start, size: s.size}
+}
+
+//Len returns the number of samples currently held
+func (s *Series) Len() int {
+	return s.size
+}
+
+//Samples returns the samples oldest first
+func (s *Series) Samples() []Sample {
+	samples := make([]Sample, s.size)
+	for i := range samples {
+		samples[i] = s.samples[(s.start+i)%len(s.samples)]
+	}
+	return samples
+}
+
+//Values returns the sample values oldest first
+func (s *Series) Values() []float64 {
+	values := make([]float64, s.size)
+	for i := range values {
+		values[i] = s.samples[(s.start+i)%len(s.samples)].Value
+	}
+	return values
+}
+
+//Labels returns the sample times oldest first formatted with the given layout e.g. for a chart's x-axis
+func (s *Series) Labels(layout string) []string {
+	labels := make([]string, s.size)
+	for i := range labels {
+		labels[i] = s.samples[(s.start+i)%len(s.samples)].At.Format(layout)
+	}
+	return labels
+}
+
+//Last returns the most recent sample or a zero sample if the series is empty
+func (s *Series) Last() Sample {
+	if s.size == 0 {
+		return Sample{}
+	}
+	return s.samples[(s.start+s.size-1)%len(s.samples)]
+}
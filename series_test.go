@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	series := NewSeries(3)
+	if series.Len() != 0 || series.Last() != (Sample{}) {
+		t.Error("Expected an empty series")
+	}
+
+	for i := 0; i < 5; i++ {
+		series.Add(start.Add(time.Duration(i)*10*time.Second), float64(i))
+	}
+
+	if series.Len() != 3 {
+		t.Error("Expected the series to be capped at its capacity", series.Len())
+	}
+	if values := series.Values(); !reflect.DeepEqual(values, []float64{2, 3, 4}) {
+		t.Error("Expected the oldest samples to be dropped", values)
+	}
+	if labels := series.Labels("15:04:05"); !reflect.DeepEqual(labels, []string{"12:00:20", "12:00:30", "12:00:40"}) {
+		t.Error("Labels are incorrect", labels)
+	}
+	if last := series.Last(); last.Value != 4 || !last.At.Equal(start.Add(40*time.Second)) {
+		t.Error("Last sample is incorrect", last)
+	}
+}
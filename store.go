@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Store persists timeseries to disk as an append-only file per series. Each line of a file is a sample written as
+//the unix time in milliseconds followed by the value.
+type Store struct {
+	dir   string
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+//NewStore constructs a store writing to the given directory, creating it if required
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".series")
+}
+
+//Load returns the samples of a series recorded at or after since, oldest first. A series that has never been
+//written has no samples.
+func (s *Store) Load(name string, since time.Time) ([]Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(name, since)
+}
+
+//read returns the samples of a series recorded at or after since
+func (s *Store) read(name string, since time.Time) ([]Sample, error) {
+	f, err := os.Open(s.path(name))
+	if os.IsNotExist(err) {
+		return []Sample{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := make([]Sample, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sample, err := parseSample(scanner.Text())
+		if err != nil {
+			//a partial line is expected if ntdash was killed mid-write
+			continue
+		}
+		if !sample.At.Before(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, scanner.Err()
+}
+
+//Prune removes the samples recorded before the given time from every series on disk
+func (s *Store) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.series"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".series")
+		//the file is about to be replaced so any open handle would write to the old file
+		if f, ok := s.files[name]; ok {
+			f.Close()
+			delete(s.files, name)
+		}
+		samples, err := s.read(name, before)
+		if err != nil {
+			return err
+		}
+		if err := s.rewrite(name, samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//rewrite atomically replaces the file of a series with the given samples
+func (s *Store) rewrite(name string, samples []Sample) error {
+	tmp, err := ioutil.TempFile(s.dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, sample := range samples {
+		fmt.Fprint(w, formatSample(sample))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+//Append writes a sample to the end of a series
+func (s *Store) Append(name string, sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		var err error
+		if f, err = os.OpenFile(s.path(name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return err
+		}
+		s.files[name] = f
+	}
+	_, err := f.WriteString(formatSample(sample))
+	return err
+}
+
+//Close closes every file opened for writing
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for name, f := range s.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, name)
+	}
+	return firstErr
+}
+
+func formatSample(sample Sample) string {
+	return fmt.Sprintf("%d %s\n", sample.At.UnixNano()/int64(time.Millisecond), strconv.FormatFloat(sample.Value, 'g', -1, 64))
+}
+
+func parseSample(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return Sample{}, fmt.Errorf("malformed sample %q", line)
+	}
+	ms, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Sample{}, err
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Sample{}, err
+	}
+	return Sample{At: time.Unix(0, ms*int64(time.Millisecond)), Value: value}, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ntdash-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if err := store.Append("heap_usage", Sample{At: start.Add(time.Duration(i) * time.Minute), Value: float64(i) + 0.5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	//a write interrupted part way through a line is ignored
+	f, err := os.OpenFile(filepath.Join(dir, "heap_usage.series"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("14832")
+	f.Close()
+
+	samples, err := store.Load("heap_usage", start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].Value != 2.5 || !samples[1].At.Equal(start.Add(3*time.Minute)) {
+		t.Error("Loaded samples are incorrect", samples)
+	}
+
+	if samples, err := store.Load("heap_usage", start); err != nil || len(samples) != 4 {
+		t.Error("Expected loading to leave older samples on disk", samples, err)
+	}
+
+	//pruning removes older samples and later appends go to the new file
+	if err := store.Prune(start.Add(3 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append("heap_usage", Sample{At: start.Add(4 * time.Minute), Value: 4.5}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "heap_usage.series"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(raw)), "\n"); len(lines) != 2 {
+		t.Error("Expected old samples to be pruned from disk", lines)
+	}
+
+	if samples, err := store.Load("unknown", start); err != nil || len(samples) != 0 {
+		t.Error("Expected no samples for an unknown series", samples, err)
+	}
+}
+
+func TestDataHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ntdash-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := FixtureExecutor{"info": "Heap Memory (MB) : 25.00 / 100.00\n    Exceptions       : 3"}
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := NewData(NewNodetoolWithExecutor(fixtures))
+	data.now = func() time.Time { return start }
+	data.EnableHistory(store, start.Add(-time.Hour), 0)
+	data.GetInfoMetrics()
+	store.Close()
+
+	//a restarted dashboard begins with the recorded history
+	restarted := NewData(NewNodetoolWithExecutor(fixtures))
+	restarted.EnableHistory(store, start.Add(-time.Hour), 0)
+	_, heap := restarted.GetInfoMetrics()
+	if values := heap.Values(); !reflect.DeepEqual(values, []float64{25, 25}) {
+		t.Error("Expected the recorded sample to be reloaded", values)
+	}
+	if restarted.IsStale("history") {
+		t.Error("History failures were reported", restarted.GetFailures())
+	}
+
+	//samples older than the history retention are pruned, at most once per prune interval
+	later := start.Add(2 * time.Hour)
+	pruned := NewData(NewNodetoolWithExecutor(fixtures))
+	pruned.now = func() time.Time { return later }
+	pruned.EnableHistory(store, start.Add(-time.Hour), time.Hour)
+	pruned.PruneHistory()
+	store.Close()
+	samples, err := store.Load("heap_usage", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sample := range samples {
+		if sample.At.Before(later.Add(-time.Hour)) {
+			t.Error("Expected samples older than the retention to be pruned", samples)
+		}
+	}
+	if !pruned.lastPrune.Equal(later) {
+		t.Error("Expected the prune time to be recorded", pruned.lastPrune)
+	}
+}
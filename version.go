@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Parser converts raw nodetool output into typed results
+type Parser interface {
+	ParseStatus(rawData string) Status
+	ParseInfo(rawData string) Info
+	ParseCfStats(rawData string) CfStats
+	ParseTpStats(rawData string) TpStats
+	ParseCompactionStats(rawData string) CompactionStats
+	ParseProxyHistograms(rawData string) ProxyHistograms
+	ParseTableHistograms(rawData string) TableHistograms
+	ParseGcStats(rawData string) GcStats
+}
+
+//Dialect describes how to query and parse nodetool for a range of Cassandra versions
+type Dialect struct {
+	Name string
+	//MinMajor is the first major Cassandra version using this dialect
+	MinMajor int
+	//CfStatsCommand is the command used to fetch keyspace and table stats
+	CfStatsCommand string
+	//TableHistogramsCommand is the command used to fetch the histograms of a single table
+	TableHistogramsCommand string
+	Parser                 Parser
+}
+
+//dialects is ordered oldest first. Versions newer than the last dialect use the last dialect. 3.x and every later
+//version share one dialect as the differences in 4.x and 5.x output (e.g. the per table pending compactions and the
+//compaction summary) are handled by the shared parsers, see the 4.0 and 5.0 goldens in testdata.
+var dialects = []Dialect{
+	{Name: "2.x", MinMajor: 2, CfStatsCommand: "cfstats", TableHistogramsCommand: "cfhistograms", Parser: &Nodetool{}},
+	{Name: "3.x+", MinMajor: 3, CfStatsCommand: "tablestats", TableHistogramsCommand: "tablehistograms", Parser: &modernParser{Parser: &Nodetool{}}},
+}
+
+//DialectForVersion returns the dialect used to talk to the given major Cassandra version
+func DialectForVersion(major int) *Dialect {
+	dialect := &dialects[0]
+	for i := range dialects {
+		if dialects[i].MinMajor <= major {
+			dialect = &dialects[i]
+		}
+	}
+	return dialect
+}
+
+//ParseVersion parses a raw nodetool version output returning the release version and its major component
+func ParseVersion(rawData string) (version string, major int, err error) {
+	parts := regexp.MustCompile(`(?m)^\s*ReleaseVersion:\s*(([0-9]+)\.[^\s]*)\s*$`).FindStringSubmatch(rawData)
+	if parts == nil {
+		return "", 0, fmt.Errorf("no release version in %q", strings.TrimSpace(rawData))
+	}
+	major, err = strconv.Atoi(parts[2])
+	return parts[1], major, err
+}
+
+//modernParser handles the changes made to nodetool output in Cassandra 3.0 and carried into later versions
+type modernParser struct {
+	Parser
+}
+
+var (
+	//tablestats puts a space before the colon of the keyspace header
+	modernKeyspacePat = regexp.MustCompile(`(?m)^(\s*)Keyspace\s+: `)
+	//keyspace latencies lost the trailing full stop
+	modernLatencyPat = regexp.MustCompile(`(?m)^(\s*(?:Read|Write) Latency: \S+ ms)$`)
+)
+
+//ParseCfStats parses tablestats output by normalising it into the cfstats format
+func (p *modernParser) ParseCfStats(rawData string) CfStats {
+	rawData = modernKeyspacePat.ReplaceAllString(rawData, "${1}Keyspace: ")
+	rawData = modernLatencyPat.ReplaceAllString(rawData, "${1}.")
+	return p.Parser.ParseCfStats(rawData)
+}
+
+//ParseInfo parses info including the chunk cache and percent repaired lines added in 3.x
+func (p *modernParser) ParseInfo(rawData string) Info {
+	info := p.Parser.ParseInfo(rawData)
+	for _, line := range strings.Split(rawData, "\n") {
+		if parts := regexp.MustCompile(`^\s*Percent Repaired\s*: ([0-9\.]+)%$`).FindAllStringSubmatch(line, 2); parts != nil {
+			info.PercentRepaired, _ = strconv.ParseFloat(parts[0][1], 64)
+		} else if parts := regexp.MustCompile(`^\s*Chunk Cache\s*: entries ([0-9]+), size (`+sizePattern+`), capacity (`+sizePattern+`), ([0-9]+) misses, ([0-9]+) requests, ([0-9\.Na]+) recent hit rate, ([0-9\.Na]+) microseconds miss latency$`).FindAllStringSubmatch(line, 2); parts != nil {
+			cache := Cache{Size: parts[0][2], Capacity: parts[0][3]}
+			cache.Entries, _ = strconv.ParseInt(parts[0][1], 10, 64)
+			cache.SizeBytes, _ = ParseBytes(cache.Size)
+			cache.CapacityBytes, _ = ParseBytes(cache.Capacity)
+			cache.Misses, _ = strconv.ParseInt(parts[0][4], 10, 64)
+			cache.Requests, _ = strconv.ParseInt(parts[0][5], 10, 64)
+			cache.RecentHitRate, _ = strconv.ParseFloat(parts[0][6], 64)
+			cache.MissLatency, _ = strconv.ParseFloat(parts[0][7], 64)
+			info.ChunkCache = cache
+		}
+	}
+	return info
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Update golden files in testdata")
+
+//loadFixtures reads every raw nodetool output in a testdata directory keyed by command e.g. status.txt is "status"
+func loadFixtures(t *testing.T, dir string) FixtureExecutor {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := FixtureExecutor{}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures[strings.TrimSuffix(filepath.Base(file), ".txt")] = string(raw)
+	}
+	return fixtures
+}
+
+//assertGolden compares the result with the golden JSON file, rewriting the file if -update is set
+func assertGolden(t *testing.T, goldenFile string, result interface{}) {
+	actual, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = append(actual, '\n')
+
+	if *update {
+		if err := ioutil.WriteFile(goldenFile, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s does not match the parsed result:\n%s", goldenFile, actual)
+	}
+}
+
+func TestGoldenFixtures(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "cassandra-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("No fixtures found")
+	}
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			fixtures := loadFixtures(t, dir)
+			nt := NewNodetoolWithExecutor(fixtures)
+
+			for command, fetch := range dumpCommands {
+				result, err := fetch(nt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertGolden(t, filepath.Join(dir, command+".golden.json"), result)
+			}
+
+			//table histograms take arguments so the fixture is stored under the bare command
+			command := nt.getDialect().TableHistogramsCommand
+			fixtures[command+" ks1 users"] = fixtures[command]
+			histograms, err := nt.GetTableHistograms("ks1", "users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, filepath.Join(dir, "tablehistograms.golden.json"), histograms)
+
+			expectedVersion := strings.TrimPrefix(strings.TrimSpace(fixtures["version"]), "ReleaseVersion: ")
+			if nt.Version != expectedVersion {
+				t.Error("Version was not detected", nt.Version)
+			}
+		})
+	}
+}
+
+//countingExecutor counts the commands run against a node that never answers
+type countingExecutor struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (e *countingExecutor) Execute(args ...string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.count++
+	return "", fmt.Errorf("nodetool %s: connection refused", strings.Join(args, " "))
+}
+
+func TestDialectDetectionBacksOff(t *testing.T) {
+	executor := &countingExecutor{}
+	nt := NewNodetoolWithExecutor(executor)
+	for i := 0; i < 7; i++ {
+		if dialect := nt.getDialect(); dialect != &dialects[0] {
+			t.Error("Expected the oldest dialect when the version is unknown", dialect.Name)
+		}
+	}
+	if executor.count != 1 {
+		t.Error("Expected detection to back off after a failure", executor.count)
+	}
+
+	nt.retryAt = time.Now()
+	nt.getDialect()
+	if executor.count != 2 || nt.retryDelay != 2*minDetectionRetry {
+		t.Error("Expected detection to be retried with a longer delay", executor.count, nt.retryDelay)
+	}
+}
+
+func TestDialectForVersion(t *testing.T) {
+	cases := map[int]string{1: "2.x", 2: "2.x", 3: "3.x+", 4: "3.x+", 5: "3.x+", 6: "3.x+"}
+	for major, expected := range cases {
+		if dialect := DialectForVersion(major); dialect.Name != expected {
+			t.Error("Incorrect dialect for", major, dialect.Name)
+		}
+	}
+
+	if _, _, err := ParseVersion("error: connection refused"); err == nil {
+		t.Error("Expected an error for output without a version")
+	}
+}